@@ -0,0 +1,385 @@
+package ddbmap
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/expression"
+	"time"
+)
+
+const (
+	// MaxTransactionItems is the maximum number of items that can be written in a single transaction.
+	MaxTransactionItems = 25
+	// The maximum number of items in a single BatchWriteItem request.
+	maxBatchWriteItems = 25
+	// The maximum number of keys in a single BatchGetItem request.
+	maxBatchGetItems = 100
+	// How many times a batch request is sent before giving up on any items left unprocessed,
+	// or on a retryable error.
+	maxBatchAttempts = 10
+	// The wait before resending unprocessed batch items, doubled after each attempt.
+	batchRetryDelay = 50 * time.Millisecond
+)
+
+func asItems(vals []Itemable) []Item {
+	items := make([]Item, len(vals))
+	for i, val := range vals {
+		items[i] = val.AsItem()
+	}
+	return items
+}
+
+// BatchResult reports how many items of a batch write were written, and the key(s) of those that were not.
+type BatchResult struct {
+	// Attempted is how many items were to be written.
+	Attempted int
+	// Succeeded is how many items were written.
+	Succeeded int
+	// FailedKeys are the key(s) of the items that were not written, or may not have been if a request failed,
+	// such as to retry them later.
+	FailedKeys []Item
+}
+
+// StoreItems stores all of the given items, clobbering any existing items with the same key(s).
+// Items are sent using BatchWriteItem, in batches of up to 25, and any unprocessed items are resent.
+// BatchWriteItem rejects a batch with the same key(s) more than once, so if several of the given items have
+// the same key(s), only the last of them is stored, and it is counted once in the returned result.
+// The writes are not atomic, so if an error is returned some of the items may have been stored,
+// and the returned result has the key(s) of the items that were not.
+func (d *DynamoMap) StoreItems(items ...Itemable) (BatchResult, error) {
+	result, _, err := d.putBatch(context.Background(), asItems(items))
+	return result, err
+}
+
+// putBatch stores the given items using BatchWriteItem, skipping any item with the same key(s) as a later item.
+// It returns the result, and those of the given items that were not stored, or may not have been.
+func (d *DynamoMap) putBatch(ctx context.Context, items []Item) (BatchResult, []Item, error) {
+	requests := make([]dynamodb.WriteRequest, 0, len(items))
+	originals := make(map[string]Item, len(items))
+	positions := make(map[string]int, len(items))
+	for _, item := range items {
+		prepared, err := d.prepareItem(item, true, false)
+		if err != nil {
+			return BatchResult{}, items, err
+		}
+		request := dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: prepared}}
+		id := d.ToKeyItem(prepared).keyString()
+		originals[id] = item
+		if i, ok := positions[id]; ok {
+			d.debug("batch write replacing item with duplicate key:", d.ToKeyItem(prepared))
+			requests[i] = request
+			continue
+		}
+		positions[id] = len(requests)
+		requests = append(requests, request)
+	}
+	result, err := d.writeBatch(ctx, requests)
+	var failed []Item
+	for _, key := range result.FailedKeys {
+		failed = append(failed, originals[key.keyString()])
+	}
+	return result, failed, err
+}
+
+// DeleteItems deletes any existing items with the same key(s) as the given items.
+// Keys are sent using BatchWriteItem, in batches of up to 25, and any unprocessed keys are resent.
+// Duplicate keys are only deleted once, so are counted once in the returned result.
+// The deletes are not atomic, so if an error is returned some of the items may have been deleted,
+// and the returned result has the key(s) of the items that were not.
+func (d *DynamoMap) DeleteItems(keys ...Itemable) (BatchResult, error) {
+	keyItems, err := d.batchKeys(keys)
+	if err != nil {
+		return BatchResult{}, err
+	}
+	requests := make([]dynamodb.WriteRequest, len(keyItems))
+	for i, key := range keyItems {
+		requests[i] = dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{Key: key}}
+	}
+	return d.writeBatch(context.Background(), requests)
+}
+
+// writeBatch sends the given write requests in batches, reporting which were not written.
+func (d *DynamoMap) writeBatch(ctx context.Context, requests []dynamodb.WriteRequest) (BatchResult, error) {
+	failed, err := d.batchWrite(ctx, requests)
+	result := BatchResult{Attempted: len(requests), Succeeded: len(requests) - len(failed)}
+	for _, request := range failed {
+		if request.PutRequest != nil {
+			result.FailedKeys = append(result.FailedKeys, d.ToKeyItem(request.PutRequest.Item))
+		} else if request.DeleteRequest != nil {
+			result.FailedKeys = append(result.FailedKeys, request.DeleteRequest.Key)
+		}
+	}
+	return result, err
+}
+
+// StoreItemsIf stores all of the given items if the condition is true for every one of them,
+// as evaluated against any existing item with the same key(s). Returns true if the items were stored.
+// The items are written atomically using TransactWriteItems, so at most MaxTransactionItems may be given.
+func (d *DynamoMap) StoreItemsIf(condition expression.ConditionBuilder, items ...Itemable) (stored bool, err error) {
+	return d.storeItems(context.Background(), asItems(items), &condition)
+}
+
+// StoreItemsIfAbsent stores all of the given items if none of them have the same key(s) as an existing item,
+// returning true if stored.
+// The items are written atomically using TransactWriteItems, so at most MaxTransactionItems may be given.
+func (d *DynamoMap) StoreItemsIfAbsent(items ...Itemable) (stored bool, err error) {
+	noKey := expression.Name(d.HashKeyName).AttributeNotExists()
+	return d.storeItems(context.Background(), asItems(items), &noKey)
+}
+
+// storeItems writes items in batches if there is no condition, or in a single transaction if there is.
+func (d *DynamoMap) storeItems(ctx context.Context, items []Item, condition *expression.ConditionBuilder) (bool,
+	error) {
+	if condition == nil {
+		_, _, err := d.putBatch(ctx, items)
+		return true, err
+	}
+
+	if len(items) > MaxTransactionItems {
+		return false, fmt.Errorf("cannot store %d items in a transaction, max %d", len(items), MaxTransactionItems)
+	}
+	condExpr, err := expression.NewBuilder().WithCondition(*condition).Build()
+	if err != nil {
+		return false, err
+	}
+	writes := make([]dynamodb.TransactWriteItem, len(items))
+	for i, item := range items {
+		prepared, err := d.prepareItem(item, true, false)
+		if err != nil {
+			return false, err
+		}
+		writes[i] = dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+			TableName:                 &d.TableName,
+			Item:                      prepared,
+			ConditionExpression:       condExpr.Condition(),
+			ExpressionAttributeNames:  condExpr.Names(),
+			ExpressionAttributeValues: condExpr.Values(),
+		}}
+	}
+	return d.transactWrite(writes)
+}
+
+// batchWrite sends the given write requests in batches, resending unprocessed requests with backoff.
+// It returns the context error if the context is done before all requests are sent.
+// If an error is returned, so are the requests that were not processed, or may not have been.
+func (d *DynamoMap) batchWrite(ctx context.Context, requests []dynamodb.WriteRequest) (
+	failed []dynamodb.WriteRequest, err error) {
+	attempts := 0
+	for len(requests) > 0 {
+		n := len(requests)
+		if n > maxBatchWriteItems {
+			n = maxBatchWriteItems
+		}
+		input := &dynamodb.BatchWriteItemInput{
+			RequestItems:           map[string][]dynamodb.WriteRequest{d.TableName: requests[:n]},
+			ReturnConsumedCapacity: d.returnCapacity(),
+		}
+		if d.dryRun("batch write", input) {
+			requests = requests[n:]
+			continue
+		}
+		d.debug("batch write request input:", input)
+		req := d.Client.BatchWriteItemRequest(input)
+		sendCtx, end := d.startSpan(ctx, "BatchWriteItem", nil)
+		resp, err := req.Send(sendCtx)
+		err = requestError("BatchWriteItem", req.Request, err)
+		d.onRequestError(err)
+		end(err)
+		d.debug("batch write response:", resp, ", error:", err)
+		if err != nil {
+			if attempts++; !IsRetryable(err) || attempts >= maxBatchAttempts {
+				return requests, err
+			}
+			d.debug("batch write retrying, attempt:", attempts)
+			if err = sleepContext(ctx, batchRetryDelay<<uint(attempts-1)); err != nil {
+				return requests, err
+			}
+			continue
+		}
+		d.reportCapacity("batch write", resp.ConsumedCapacity...)
+		unprocessed := resp.UnprocessedItems[d.TableName]
+		if len(unprocessed) == 0 {
+			attempts = 0
+			requests = requests[n:]
+			continue
+		}
+		requests = append(unprocessed, requests[n:]...)
+		if attempts++; attempts >= maxBatchAttempts {
+			return requests, fmt.Errorf("%d batch write requests unprocessed after %d attempts", len(unprocessed),
+				attempts)
+		}
+		d.debug("batch write unprocessed:", len(unprocessed), ", attempt:", attempts)
+		if err = sleepContext(ctx, batchRetryDelay<<uint(attempts-1)); err != nil {
+			return requests, err
+		}
+	}
+	return nil, nil
+}
+
+// sleepContext waits for the given duration, or returns the context error if the context is done first.
+func sleepContext(ctx context.Context, wait time.Duration) error {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// transactWrite sends the given writes as a single transaction,
+// returning false without error if the transaction was canceled because a condition failed.
+func (d *DynamoMap) transactWrite(writes []dynamodb.TransactWriteItem) (bool, error) {
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems:          writes,
+		ReturnConsumedCapacity: d.returnCapacity(),
+	}
+	if d.dryRun("transact write", input) {
+		return true, nil
+	}
+	d.debug("transact write request input:", input)
+	req := d.Client.TransactWriteItemsRequest(input)
+	sendCtx, end := d.startSpan(context.Background(), "TransactWriteItems", nil)
+	resp, err := req.Send(sendCtx)
+	err = requestError("TransactWriteItems", req.Request, err)
+	d.onRequestError(err)
+	end(err)
+	d.debug("transact write response:", resp, ", error:", err)
+	if err != nil {
+		if isConditionCanceled(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	d.reportCapacity("transact write", resp.ConsumedCapacity...)
+	return true, nil
+}
+
+// ExistingKeys returns the keys of the given items that are the key(s) of stored items, such as to find
+// duplicates before storing. Only the key attributes of stored items are read, using BatchGetItem.
+// The returned keys are in no particular order.
+func (d *DynamoMap) ExistingKeys(keys []Itemable) ([]Item, error) {
+	keyItems, err := d.batchKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+	projection := d.keyProjection()
+	return d.batchGet(keyItems, &projection)
+}
+
+// LoadItems returns the stored items with the same key(s) as any of the given keys, using BatchGetItem.
+// If any attributes are given, only those attributes of each item are read, which consumes less read capacity
+// for large items. An attribute may be a dot separated path into nested maps.
+// Include the key attributes to match the returned items with their keys.
+// Keys with no stored item are skipped, and the returned items are in no particular order.
+func (d *DynamoMap) LoadItems(keys []Itemable, attrs ...string) ([]Item, error) {
+	keyItems, err := d.batchKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(attrs) == 0 {
+		return d.batchGet(keyItems, nil)
+	}
+	projection := expression.NamesList(expression.Name(attrs[0]))
+	for _, attr := range attrs[1:] {
+		projection = projection.AddNames(expression.Name(attr))
+	}
+	return d.batchGet(keyItems, &projection)
+}
+
+// batchKeys returns the key items of the given keys, without duplicates, which BatchGetItem rejects.
+func (d *DynamoMap) batchKeys(keys []Itemable) ([]Item, error) {
+	keyItems := make([]Item, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		keyItem, err := d.checkKeyTypes(d.ToKeyItem(key.AsItem()))
+		if err != nil {
+			return nil, err
+		}
+		if id := keyItem.keyString(); !seen[id] {
+			seen[id] = true
+			keyItems = append(keyItems, keyItem)
+		}
+	}
+	return keyItems, nil
+}
+
+// keyProjection returns a projection of the key attributes.
+func (d *DynamoMap) keyProjection() expression.ProjectionBuilder {
+	names := []expression.NameBuilder{expression.Name(d.HashKeyName)}
+	if d.Ranged() {
+		names = append(names, expression.Name(d.RangeKeyName))
+	}
+	return expression.NamesList(names[0], names[1:]...)
+}
+
+// batchGet loads the items with the given keys in batches, resending unprocessed keys with backoff.
+// If projection is not nil, only the projected attributes are read.
+func (d *DynamoMap) batchGet(keys []Item, projection *expression.ProjectionBuilder) ([]Item, error) {
+	request := dynamodb.KeysAndAttributes{ConsistentRead: &d.ReadWithStrongConsistency}
+	if projection != nil {
+		expr, err := expression.NewBuilder().WithProjection(*projection).Build()
+		if err != nil {
+			return nil, err
+		}
+		request.ProjectionExpression = expr.Projection()
+		request.ExpressionAttributeNames = expr.Names()
+	}
+	remaining := make([]map[string]dynamodb.AttributeValue, len(keys))
+	for i, key := range keys {
+		remaining[i] = key
+	}
+
+	var result []Item
+	attempts := 0
+	for len(remaining) > 0 {
+		n := len(remaining)
+		if n > maxBatchGetItems {
+			n = maxBatchGetItems
+		}
+		request.Keys = remaining[:n]
+		input := &dynamodb.BatchGetItemInput{
+			RequestItems:           map[string]dynamodb.KeysAndAttributes{d.TableName: request},
+			ReturnConsumedCapacity: d.returnCapacity(),
+		}
+		d.debug("batch get request input:", input)
+		req := d.reader().BatchGetItemRequest(input)
+		sendCtx, end := d.startSpan(context.Background(), "BatchGetItem", nil)
+		resp, err := req.Send(sendCtx)
+		err = requestError("BatchGetItem", req.Request, err)
+		d.onRequestError(err)
+		end(err)
+		d.debug("batch get response:", resp, ", error:", err)
+		if err != nil {
+			if attempts++; !IsRetryable(err) || attempts >= maxBatchAttempts {
+				return result, err
+			}
+			d.debug("batch get retrying, attempt:", attempts)
+			time.Sleep(batchRetryDelay << uint(attempts-1))
+			continue
+		}
+		d.reportCapacity("batch get", resp.ConsumedCapacity...)
+		for _, item := range resp.Responses[d.TableName] {
+			decoded, err := d.decodeItem(item)
+			if err != nil {
+				return result, err
+			}
+			result = append(result, decoded)
+		}
+		unprocessed := resp.UnprocessedKeys[d.TableName].Keys
+		if len(unprocessed) == 0 {
+			attempts = 0
+			remaining = remaining[n:]
+			continue
+		}
+		if attempts++; attempts >= maxBatchAttempts {
+			return result, fmt.Errorf("%d batch get keys unprocessed after %d attempts", len(unprocessed), attempts)
+		}
+		d.debug("batch get unprocessed:", len(unprocessed), ", attempt:", attempts)
+		time.Sleep(batchRetryDelay << uint(attempts-1))
+		remaining = append(unprocessed, remaining[n:]...)
+	}
+	return result, nil
+}
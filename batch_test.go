@@ -0,0 +1,48 @@
+package ddbmap
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/shawnsmithdev/ddbmap/ddbconv"
+	"testing"
+)
+
+func TestStoreItemsDuplicateKeysLastWins(t *testing.T) {
+	var written []Item
+	client, closeServer := fakeDynamo(t, func(op string, body []byte) interface{} {
+		if op != "BatchWriteItem" {
+			return unexpectedRequest(t, "unexpected operation", op)
+		}
+		var input dynamodb.BatchWriteItemInput
+		if err := json.Unmarshal(body, &input); err != nil {
+			return unexpectedRequest(t, "cannot parse batch write input", err)
+		}
+		for _, request := range input.RequestItems["Test"] {
+			written = append(written, request.PutRequest.Item)
+		}
+		return dynamodb.BatchWriteItemOutput{}
+	})
+	defer closeServer()
+	d := &DynamoMap{TableConfig: TableConfig{TableName: "Test", HashKeyName: "Id"}, Client: client}
+
+	result, err := d.StoreItems(
+		Item{"Id": ddbconv.EncodeString("a"), "N": ddbconv.EncodeInt(1)},
+		Item{"Id": ddbconv.EncodeString("b"), "N": ddbconv.EncodeInt(2)},
+		Item{"Id": ddbconv.EncodeString("a"), "N": ddbconv.EncodeInt(3)})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if result.Attempted != 2 || result.Succeeded != 2 {
+		t.Error("expected 2 attempted and succeeded, got", result)
+	}
+	if len(written) != 2 {
+		t.Fatal("expected 2 items written, got", written)
+	}
+	if id, n := ddbconv.DecodeString(written[0]["Id"]), ddbconv.DecodeInt(written[0]["N"]); id != "a" || n != 3 {
+		t.Error("expected", "a", 3, "got", id, n)
+	}
+	if n := aws.StringValue(written[1]["N"].N); n != "2" {
+		t.Error("expected", "2", "got", n)
+	}
+}
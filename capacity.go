@@ -0,0 +1,65 @@
+package ddbmap
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// CapacityReport is the capacity consumed by a single request, broken down by table and secondary index.
+type CapacityReport struct {
+	// The operation that made the request, such as "load", "store", "delete", "scan", or "query".
+	Operation string
+	// The total capacity units consumed.
+	Total float64
+	// The capacity units consumed by the table itself.
+	Table float64
+	// The capacity units consumed by each global secondary index, by index name.
+	GlobalSecondaryIndexes map[string]float64
+	// The capacity units consumed by each local secondary index, by index name.
+	LocalSecondaryIndexes map[string]float64
+}
+
+func capacityUnits(indexes map[string]dynamodb.Capacity) map[string]float64 {
+	if len(indexes) == 0 {
+		return nil
+	}
+	result := make(map[string]float64, len(indexes))
+	for name, capacity := range indexes {
+		result[name] = aws.Float64Value(capacity.CapacityUnits)
+	}
+	return result
+}
+
+// returnCapacity returns the level of consumed capacity to request, which is none unless CapacityReporter is set.
+func (d *DynamoMap) returnCapacity() dynamodb.ReturnConsumedCapacity {
+	if d.CapacityReporter == nil {
+		return ""
+	}
+	return dynamodb.ReturnConsumedCapacityIndexes
+}
+
+// reportCapacity passes consumed capacity from a response to the CapacityReporter, if set.
+func (d *DynamoMap) reportCapacity(op string, consumed ...dynamodb.ConsumedCapacity) {
+	if d.CapacityReporter == nil {
+		return
+	}
+	for _, cc := range consumed {
+		report := CapacityReport{
+			Operation:              op,
+			Total:                  aws.Float64Value(cc.CapacityUnits),
+			GlobalSecondaryIndexes: capacityUnits(cc.GlobalSecondaryIndexes),
+			LocalSecondaryIndexes:  capacityUnits(cc.LocalSecondaryIndexes),
+		}
+		if cc.Table != nil {
+			report.Table = aws.Float64Value(cc.Table.CapacityUnits)
+		}
+		d.CapacityReporter(report)
+	}
+}
+
+// reportCapacityOf reports the consumed capacity of a single request response, if any.
+func (d *DynamoMap) reportCapacityOf(op string, consumed *dynamodb.ConsumedCapacity) {
+	if consumed != nil {
+		d.reportCapacity(op, *consumed)
+	}
+}
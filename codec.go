@@ -0,0 +1,83 @@
+package ddbmap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+)
+
+// Codec transforms the content of a binary attribute as it is stored and loaded.
+type Codec interface {
+	// Encode transforms a binary value before it is stored.
+	Encode(decoded []byte) ([]byte, error)
+	// Decode reverses Encode on a binary value after it is loaded.
+	Decode(encoded []byte) ([]byte, error)
+}
+
+// GzipCodec is a Codec that compresses binary attributes with gzip.
+type GzipCodec struct {
+	// Level is the gzip compression level. If zero, gzip.DefaultCompression is used.
+	Level int
+}
+
+// Encode compresses the given bytes.
+func (g GzipCodec) Encode(decoded []byte) ([]byte, error) {
+	level := g.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(decoded); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode decompresses the given bytes.
+func (g GzipCodec) Decode(encoded []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(encoded))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// applyCodecs returns a copy of the item with the codec for each named binary attribute applied.
+// If no codec applies, the item itself is returned.
+func applyCodecs(item Item, codecs map[string]Codec, encode bool) (Item, error) {
+	var result Item
+	for attr, codec := range codecs {
+		av, ok := item[attr]
+		if !ok || av.B == nil {
+			continue
+		}
+		if result == nil {
+			result = make(Item, len(item))
+			for k, v := range item {
+				result[k] = v
+			}
+		}
+		var err error
+		if encode {
+			av.B, err = codec.Encode(av.B)
+		} else {
+			av.B, err = codec.Decode(av.B)
+		}
+		if err != nil {
+			return nil, err
+		}
+		result[attr] = av
+	}
+	if result == nil {
+		return item, nil
+	}
+	return result, nil
+}
@@ -0,0 +1,75 @@
+package ddbmap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/shawnsmithdev/ddbmap/ddbconv"
+	"reflect"
+	"testing"
+)
+
+func TestGzipCodecRoundTrip(t *testing.T) {
+	large := bytes.Repeat([]byte("ddbmap "), 10000)
+	for _, level := range []int{0, gzip.NoCompression, gzip.BestSpeed, gzip.BestCompression} {
+		for _, val := range [][]byte{{}, []byte("a"), large} {
+			codec := GzipCodec{Level: level}
+			encoded, err := codec.Encode(val)
+			if err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			decoded, err := codec.Decode(encoded)
+			if err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			if !bytes.Equal(decoded, val) {
+				t.Error("level", level, "expected", len(val), "bytes, got", len(decoded))
+			}
+		}
+	}
+	if encoded, _ := (GzipCodec{}).Encode(large); len(encoded) >= len(large) {
+		t.Error("expected compression, got", len(encoded), "bytes from", len(large))
+	}
+}
+
+func TestGzipCodecErrors(t *testing.T) {
+	if _, err := (GzipCodec{Level: 42}).Encode([]byte("a")); err == nil {
+		t.Error("expected an error for an invalid level")
+	}
+	if _, err := (GzipCodec{}).Decode([]byte("not gzip")); err == nil {
+		t.Error("expected an error for data that is not gzip")
+	}
+}
+
+func TestAttributeCodecsRoundTrip(t *testing.T) {
+	d := &DynamoMap{TableConfig: TableConfig{
+		TableName:       "Test",
+		HashKeyName:     "Id",
+		AttributeCodecs: map[string]Codec{"Body": GzipCodec{}, "Name": GzipCodec{}, "Missing": GzipCodec{}},
+	}}
+	item := Item{
+		"Id":   ddbconv.EncodeString("a"),
+		"Body": ddbconv.EncodeBinary([]byte("hello, hello, hello")),
+		// codecs only apply to binary values
+		"Name": ddbconv.EncodeString("n"),
+	}
+	encoded, err := d.encodeItem(item)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if bytes.Equal(encoded["Body"].B, item["Body"].B) {
+		t.Error("expected Body to be encoded")
+	}
+	if !reflect.DeepEqual(encoded["Name"], item["Name"]) || !reflect.DeepEqual(encoded["Id"], item["Id"]) {
+		t.Error("expected other attributes to be unchanged, got", encoded)
+	}
+	if string(item["Body"].B) != "hello, hello, hello" {
+		t.Error("expected the given item to be unchanged, got", item)
+	}
+	decoded, err := d.decodeItem(encoded)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if !reflect.DeepEqual(decoded, item) {
+		t.Error("expected", item, "got", decoded)
+	}
+}
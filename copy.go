@@ -0,0 +1,73 @@
+package ddbmap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// CopyTo scans every item in this table and stores it in the dest table using a BufferedWriter,
+// returning how many items were stored. If transform is not nil, it is applied to each item before it is stored,
+// and items it returns as nil are skipped. Copying stops at the first error from the scan, transform, or writes,
+// though items already buffered are still flushed. Items in dest with the same key(s) are overwritten.
+func (d *DynamoMap) CopyTo(dest *DynamoMap, transform func(Item) (Item, error)) (int, error) {
+	var (
+		added, failed int64
+		mu            sync.Mutex
+		firstErr      error
+	)
+	setErr := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	hasErr := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	writer := dest.NewBufferedWriter(BufferedWriterOptions{
+		OnError: func(err error, items []Item) {
+			atomic.AddInt64(&failed, int64(len(items)))
+			setErr(err)
+		},
+	})
+	rangeErr := d.RangeItems(func(item Item) bool {
+		if transform != nil {
+			var err error
+			if item, err = transform(item); err != nil {
+				setErr(err)
+				return false
+			}
+			if item == nil {
+				return true
+			}
+		}
+		if err := writer.Add(item); err != nil {
+			setErr(err)
+			return false
+		}
+		atomic.AddInt64(&added, 1)
+		return !hasErr()
+	})
+	if rangeErr != nil {
+		setErr(rangeErr)
+	}
+	// background flush errors are passed to OnError
+	if err := writer.Close(context.Background()); err != nil {
+		var unflushed *UnflushedError
+		if errors.As(err, &unflushed) {
+			atomic.AddInt64(&failed, int64(len(unflushed.Items)))
+		}
+		setErr(err)
+	}
+
+	copied := int(atomic.LoadInt64(&added) - atomic.LoadInt64(&failed))
+	mu.Lock()
+	defer mu.Unlock()
+	return copied, firstErr
+}
@@ -1,12 +1,19 @@
 // Package ddbconv can be used to convert between dynamodb.AttributeValue and the Go type system
 // Some of these functions provide little more than improved readability.
+//
+// Other fixed width integer types, such as int32 or uint16, can be converted with the Int64 and Uint64 functions,
+// such as EncodeInt64(int64(val)) and uint16(DecodeUint64(av)).
 package ddbconv
 
 import (
+	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"math"
+	"reflect"
 	"strconv"
+	"time"
 )
 
 func forbidErr(err error) {
@@ -43,6 +50,17 @@ func DecodeBinary(attr dynamodb.AttributeValue) []byte {
 	return attr.B
 }
 
+// TryDecodeBinary attempts to convert an AttributeValue into a []byte.
+// The ok result is true if the value is a Binary (B), even an empty one,
+// so a missing binary value can be distinguished from an empty one.
+func TryDecodeBinary(attr dynamodb.AttributeValue) (result []byte, ok bool) {
+	ok = attr.B != nil && !IsNull(attr)
+	if ok {
+		result = attr.B
+	}
+	return result, ok
+}
+
 // EncodeBinary converts a []byte into an AttributeValue with the Binary (B) type.
 func EncodeBinary(val []byte) dynamodb.AttributeValue {
 	return dynamodb.AttributeValue{B: val}
@@ -80,6 +98,72 @@ func EncodeInt(val int) dynamodb.AttributeValue {
 	return dynamodb.AttributeValue{N: aws.String(strconv.Itoa(val))}
 }
 
+// DecodeInt64 converts an AttributeValue into an int64, and will panic if the value is not an integral Number,
+// if it is a NULL, or if it will not fit in an int64. As with DecodeInt, the number must be written without
+// a decimal point or exponent, as DynamoDB returns integers, so 1000 is decoded, but 1e3 and 1000.0 are not.
+func DecodeInt64(av dynamodb.AttributeValue) int64 {
+	val, err := strconv.ParseInt(*av.N, 10, 64)
+	forbidErr(err)
+	return val
+}
+
+// TryDecodeInt64 attempts to convert an AttributeValue into an int64.
+// The boolean result is true if the decode was successful, as for DecodeInt64.
+func TryDecodeInt64(av dynamodb.AttributeValue) (int64, bool) {
+	if num, ok := TryDecodeNumber(av); ok {
+		val, err := strconv.ParseInt(num.String(), 10, 64)
+		return val, err == nil
+	}
+	return 0, false
+}
+
+// EncodeInt64 converts an int64 into an AttributeValue with the Number (N) type.
+func EncodeInt64(val int64) dynamodb.AttributeValue {
+	return dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(val, 10))}
+}
+
+// DecodeUint64 converts an AttributeValue into a uint64, and will panic if the value is not an integral Number,
+// if it is negative or a NULL, or if it will not fit in a uint64.
+func DecodeUint64(av dynamodb.AttributeValue) uint64 {
+	val, err := strconv.ParseUint(*av.N, 10, 64)
+	forbidErr(err)
+	return val
+}
+
+// TryDecodeUint64 attempts to convert an AttributeValue into a uint64.
+// The boolean result is true if the decode was successful.
+func TryDecodeUint64(av dynamodb.AttributeValue) (uint64, bool) {
+	if num, ok := TryDecodeNumber(av); ok {
+		val, err := strconv.ParseUint(num.String(), 10, 64)
+		return val, err == nil
+	}
+	return 0, false
+}
+
+// EncodeUint64 converts a uint64 into an AttributeValue with the Number (N) type.
+func EncodeUint64(val uint64) dynamodb.AttributeValue {
+	return dynamodb.AttributeValue{N: aws.String(strconv.FormatUint(val, 10))}
+}
+
+// DecodeDuration converts an AttributeValue holding a number of nanoseconds into a time.Duration,
+// and will panic if the value is not an integral Number, if it is a NULL, or if it will not fit in an int64.
+func DecodeDuration(av dynamodb.AttributeValue) time.Duration {
+	return time.Duration(DecodeInt64(av))
+}
+
+// TryDecodeDuration attempts to convert an AttributeValue holding a number of nanoseconds into a time.Duration.
+// The boolean result is true if the decode was successful.
+func TryDecodeDuration(av dynamodb.AttributeValue) (time.Duration, bool) {
+	val, ok := TryDecodeInt64(av)
+	return time.Duration(val), ok
+}
+
+// EncodeDuration converts a time.Duration into an AttributeValue with the Number (N) type,
+// holding the duration as a number of nanoseconds.
+func EncodeDuration(val time.Duration) dynamodb.AttributeValue {
+	return EncodeInt64(int64(val))
+}
+
 // DecodeNumber converts an AttributeValue into a Number, and will panic if the value is not a Number (N),
 // or if the value is a NULL.
 func DecodeNumber(av dynamodb.AttributeValue) dynamodbattribute.Number {
@@ -142,6 +226,28 @@ func EncodeString(val string) dynamodb.AttributeValue {
 	return dynamodb.AttributeValue{S: aws.String(val)}
 }
 
+// EncodeStringer converts a fmt.Stringer, such as a named string type with a String method,
+// into an AttributeValue with the String (S) type.
+func EncodeStringer(val fmt.Stringer) dynamodb.AttributeValue {
+	return EncodeString(val.String())
+}
+
+// DecodeStringInto sets the value pointed to by dest, which must be a pointer to a string or to a named type
+// with an underlying string type, such as `type Status string`, from an AttributeValue.
+// The ok result is true if the value is a String (S) and dest was set.
+// If dest is not a pointer to a string type, DecodeStringInto will panic.
+func DecodeStringInto(attr dynamodb.AttributeValue, dest interface{}) (ok bool) {
+	target := reflect.ValueOf(dest).Elem()
+	if target.Kind() != reflect.String {
+		panic(fmt.Sprintf("ddbconv: cannot decode string into %v", target.Type()))
+	}
+	val, ok := TryDecodeString(attr)
+	if ok {
+		target.SetString(val)
+	}
+	return ok
+}
+
 // DecodeStringSet converts an AttributeValue into a []string,
 // which will be empty if the value is not a StringSet (SS).
 func DecodeStringSet(attr dynamodb.AttributeValue) []string {
@@ -197,3 +303,63 @@ func EncodeList(val []dynamodb.AttributeValue) dynamodb.AttributeValue {
 func IsNull(attr dynamodb.AttributeValue) bool {
 	return attr.NULL != nil && *attr.NULL
 }
+
+// DecodeMapTo unmarshals an AttributeValue with the Map (M) type into dest, which must be a pointer,
+// such as to a struct or a map, using dynamodbattribute.UnmarshalMap.
+// It returns an error, and leaves dest unchanged, if the value is not a Map (M).
+func DecodeMapTo(attr dynamodb.AttributeValue, dest interface{}) error {
+	if attr.M == nil {
+		return fmt.Errorf("ddbconv: cannot decode value that is not a Map (M) into %T: %v", dest, attr)
+	}
+	return dynamodbattribute.UnmarshalMap(attr.M, dest)
+}
+
+// ToGoValue recursively converts an AttributeValue into native Go types.
+// Strings (S) become string, Numbers (N) become float64, Binary (B) becomes []byte, Booleans (BOOL) become bool,
+// and Null (NULL) becomes nil. Maps (M) become map[string]interface{} and Lists (L) become []interface{}.
+// Sets become []string, []float64, or [][]byte. Numbers that are not valid float64 values become NaN.
+func ToGoValue(attr dynamodb.AttributeValue) interface{} {
+	switch {
+	case IsNull(attr):
+		return nil
+	case attr.S != nil:
+		return *attr.S
+	case attr.N != nil:
+		return numberToFloat(*attr.N)
+	case attr.B != nil:
+		return attr.B
+	case attr.BOOL != nil:
+		return *attr.BOOL
+	case attr.M != nil:
+		result := make(map[string]interface{}, len(attr.M))
+		for k, v := range attr.M {
+			result[k] = ToGoValue(v)
+		}
+		return result
+	case attr.L != nil:
+		result := make([]interface{}, len(attr.L))
+		for i, v := range attr.L {
+			result[i] = ToGoValue(v)
+		}
+		return result
+	case attr.SS != nil:
+		return attr.SS
+	case attr.NS != nil:
+		result := make([]float64, len(attr.NS))
+		for i, n := range attr.NS {
+			result[i] = numberToFloat(n)
+		}
+		return result
+	case attr.BS != nil:
+		return attr.BS
+	}
+	return nil
+}
+
+func numberToFloat(n string) float64 {
+	val, err := strconv.ParseFloat(n, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return val
+}
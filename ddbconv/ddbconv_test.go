@@ -0,0 +1,87 @@
+package ddbconv
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"math"
+	"testing"
+)
+
+func TestTryDecodeInt64(t *testing.T) {
+	tests := []struct {
+		n    string
+		want int64
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"42", 42, true},
+		{"-42", -42, true},
+		{"+42", 42, true},
+		{"007", 7, true},
+		{"9223372036854775807", math.MaxInt64, true},
+		{"-9223372036854775808", math.MinInt64, true},
+		{"9223372036854775808", 0, false},
+		{"-9223372036854775809", 0, false},
+		{"1e3", 0, false},
+		{"1000.0", 0, false},
+		{"1.5", 0, false},
+		{"", 0, false},
+		{"ten", 0, false},
+	}
+	for _, test := range tests {
+		val, ok := TryDecodeInt64(dynamodb.AttributeValue{N: aws.String(test.n)})
+		if ok != test.ok || (ok && val != test.want) {
+			t.Error("for", test.n, "expected", test.want, test.ok, "got", val, ok)
+		}
+	}
+	if _, ok := TryDecodeInt64(EncodeString("42")); ok {
+		t.Error("expected a String (S) not to decode")
+	}
+	if _, ok := TryDecodeInt64(dynamodb.AttributeValue{NULL: aws.Bool(true)}); ok {
+		t.Error("expected a NULL not to decode")
+	}
+}
+
+func TestDecodeInt64RoundTrip(t *testing.T) {
+	for _, val := range []int64{0, 1, -1, math.MaxInt64, math.MinInt64} {
+		if got := DecodeInt64(EncodeInt64(val)); got != val {
+			t.Error("expected", val, "got", got)
+		}
+	}
+}
+
+func TestDecodeInt64PanicsOnInvalid(t *testing.T) {
+	for _, n := range []string{"1e3", "1.5", "9223372036854775808", "ten"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic for", n)
+				}
+			}()
+			DecodeInt64(dynamodb.AttributeValue{N: aws.String(n)})
+		}()
+	}
+}
+
+func TestDecodeMapTo(t *testing.T) {
+	type named struct {
+		Name string
+	}
+	var dest named
+	if err := DecodeMapTo(dynamodb.AttributeValue{M: map[string]dynamodb.AttributeValue{
+		"Name": EncodeString("n")}}, &dest); err != nil || dest.Name != "n" {
+		t.Error("expected", "n", "got", dest.Name, err)
+	}
+	for _, attr := range []dynamodb.AttributeValue{
+		EncodeString("n"),
+		EncodeInt(1),
+		{NULL: aws.Bool(true)},
+		{L: []dynamodb.AttributeValue{EncodeString("n")}},
+		{},
+	} {
+		dest := named{Name: "unchanged"}
+		if err := DecodeMapTo(attr, &dest); err == nil || dest.Name != "unchanged" {
+			t.Error("expected an error and no change for", attr, "got", dest, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package ddbconv
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"net"
+)
+
+// EncodeIP converts a net.IP into an AttributeValue with the Binary (B) type, 4 bytes long for an IPv4 address,
+// including an IPv4 address in IPv6 form, or 16 bytes long for an IPv6 address,
+// so every address has one stored form. EncodeIP will panic if the value is not a valid IP address.
+func EncodeIP(ip net.IP) dynamodb.AttributeValue {
+	if ip4 := ip.To4(); ip4 != nil {
+		return EncodeBinary([]byte(ip4))
+	}
+	if ip16 := ip.To16(); ip16 != nil {
+		return EncodeBinary([]byte(ip16))
+	}
+	panic(fmt.Sprintf("ddbconv: cannot encode invalid IP address: %v", []byte(ip)))
+}
+
+// DecodeIP converts an AttributeValue into a net.IP,
+// which will be nil if the value is not a Binary (B) 4 or 16 bytes long.
+func DecodeIP(attr dynamodb.AttributeValue) net.IP {
+	result, _ := TryDecodeIP(attr)
+	return result
+}
+
+// TryDecodeIP attempts to convert an AttributeValue into a net.IP.
+// The ok result is true if the value is a Binary (B) 4 or 16 bytes long, as encoded by EncodeIP.
+func TryDecodeIP(attr dynamodb.AttributeValue) (result net.IP, ok bool) {
+	val, ok := TryDecodeBinary(attr)
+	if !ok || (len(val) != net.IPv4len && len(val) != net.IPv6len) {
+		return nil, false
+	}
+	return append(net.IP(nil), val...), true
+}
+
+// EncodeUUID converts a UUID into an AttributeValue with the Binary (B) type, 16 bytes long.
+// UUID types with an underlying [16]byte type, such as uuid.UUID of github.com/google/uuid, can be passed directly.
+func EncodeUUID(id [16]byte) dynamodb.AttributeValue {
+	return EncodeBinary(append([]byte(nil), id[:]...))
+}
+
+// EncodeUUIDString converts a UUID into an AttributeValue with the String (S) type, in the canonical
+// lower case form, such as 123e4567-e89b-12d3-a456-426614174000, for when a UUID must be readable or sortable
+// as a string, such as a key shared with other systems. Otherwise, EncodeUUID is more compact.
+func EncodeUUIDString(id [16]byte) dynamodb.AttributeValue {
+	var buf [36]byte
+	hex.Encode(buf[0:8], id[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], id[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], id[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], id[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], id[10:])
+	return EncodeString(string(buf[:]))
+}
+
+// DecodeUUID converts an AttributeValue into a UUID,
+// which will be all zeros if the value is not a UUID encoded by EncodeUUID or EncodeUUIDString.
+func DecodeUUID(attr dynamodb.AttributeValue) [16]byte {
+	result, _ := TryDecodeUUID(attr)
+	return result
+}
+
+// TryDecodeUUID attempts to convert an AttributeValue into a UUID. The ok result is true if the value is
+// a Binary (B) 16 bytes long, as encoded by EncodeUUID, or a String (S) in the canonical form of either case,
+// as encoded by EncodeUUIDString, so UUIDs stored either way can be read.
+func TryDecodeUUID(attr dynamodb.AttributeValue) (result [16]byte, ok bool) {
+	if val, ok := TryDecodeBinary(attr); ok {
+		if len(val) != len(result) {
+			return result, false
+		}
+		copy(result[:], val)
+		return result, true
+	}
+	val, ok := TryDecodeString(attr)
+	if !ok || len(val) != 36 || val[8] != '-' || val[13] != '-' || val[18] != '-' || val[23] != '-' {
+		return result, false
+	}
+	digits := val[0:8] + val[9:13] + val[14:18] + val[19:23] + val[24:]
+	if _, err := hex.Decode(result[:], []byte(digits)); err != nil {
+		return [16]byte{}, false
+	}
+	return result, true
+}
@@ -0,0 +1,87 @@
+package ddbconv
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"math"
+	"math/big"
+	"strings"
+)
+
+var bigFive = big.NewInt(5)
+
+// requireRat parses a Number exactly, and will panic if it is not a valid number.
+// Only decimal numbers are valid, though big.Rat also parses fractions such as 1/2, and hexadecimal such as 0x10.
+func requireRat(n dynamodbattribute.Number) *big.Rat {
+	s := n.String()
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || strings.IndexFunc(s, notDecimalRune) >= 0 {
+		panic(fmt.Sprintf("invalid number: %q", n))
+	}
+	return r
+}
+
+// notDecimalRune returns true if c cannot be part of a decimal number.
+func notDecimalRune(c rune) bool {
+	return !strings.ContainsRune("0123456789.+-eE", c)
+}
+
+// ratToNumber formats an exact decimal as a Number, without an exponent or trailing zeros.
+// The denominator of an exact decimal has no prime factors other than 2 and 5,
+// and it has as many decimal places as the larger count of either factor.
+func ratToNumber(r *big.Rat) dynamodbattribute.Number {
+	denom := new(big.Int).Set(r.Denom())
+	twos := int(denom.TrailingZeroBits())
+	denom.Rsh(denom, uint(twos))
+	fives := 0
+	for quo, rem := new(big.Int), new(big.Int); ; fives++ {
+		if quo.QuoRem(denom, bigFive, rem); rem.Sign() != 0 {
+			break
+		}
+		denom.Set(quo)
+	}
+	places := twos
+	if fives > places {
+		places = fives
+	}
+	return dynamodbattribute.Number(r.FloatString(places))
+}
+
+// AddNumbers returns the exact sum of two Numbers, and will panic if either is not a valid number.
+// Unlike adding them as float64 values, no precision is lost, though DynamoDB will reject
+// a result with more than 38 significant digits.
+func AddNumbers(a, b dynamodbattribute.Number) dynamodbattribute.Number {
+	return ratToNumber(new(big.Rat).Add(requireRat(a), requireRat(b)))
+}
+
+// CompareNumbers compares two Numbers exactly, returning -1 if a < b, 0 if a == b, and +1 if a > b.
+// It will panic if either is not a valid number.
+func CompareNumbers(a, b dynamodbattribute.Number) int {
+	return requireRat(a).Cmp(requireRat(b))
+}
+
+// NumberToFloat converts a Number into the nearest float64, and will panic if it is not a valid number.
+// The exact result is true if no precision was lost, such as for 0.5 but not 0.1.
+// Numbers too large for a float64 are converted to positive or negative infinity, and exact is false.
+func NumberToFloat(n dynamodbattribute.Number) (val float64, exact bool) {
+	val, exact = requireRat(n).Float64()
+	return val, exact && !math.IsInf(val, 0)
+}
+
+// NumberToInt converts a Number into an int, and will panic if it is not a valid number.
+// The ok result is false, and val is zero, if the number is not an integer or will not fit in an int.
+func NumberToInt(n dynamodbattribute.Number) (val int, ok bool) {
+	r := requireRat(n)
+	if !r.IsInt() {
+		return 0, false
+	}
+	num := r.Num()
+	if !num.IsInt64() {
+		return 0, false
+	}
+	i64 := num.Int64()
+	if int64(int(i64)) != i64 {
+		return 0, false
+	}
+	return int(i64), true
+}
@@ -0,0 +1,128 @@
+package ddbconv
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"math/big"
+	"testing"
+)
+
+func TestRatToNumber(t *testing.T) {
+	tests := []struct {
+		r    string
+		want dynamodbattribute.Number
+	}{
+		{"0", "0"},
+		{"-0", "0"},
+		{"10", "10"},
+		{"1.500", "1.5"},
+		{"-2.50", "-2.5"},
+		{"1/8", "0.125"},
+		{"1/20", "0.05"},
+		{"1e3", "1000"},
+		{"1.25e-3", "0.00125"},
+		{"-3E2", "-300"},
+	}
+	for _, test := range tests {
+		r, ok := new(big.Rat).SetString(test.r)
+		if !ok {
+			t.Fatal("invalid test number", test.r)
+		}
+		if got := ratToNumber(r); got != test.want {
+			t.Error("for", test.r, "expected", test.want, "got", got)
+		}
+	}
+}
+
+func TestAddNumbers(t *testing.T) {
+	tests := []struct {
+		a, b, want dynamodbattribute.Number
+	}{
+		{"1", "2", "3"},
+		{"0.1", "0.2", "0.3"},
+		{"1.50", "1.50", "3"},
+		{"-5", "3", "-2"},
+		{"-0.25", "0.25", "0"},
+		{"1e3", "1", "1001"},
+		{"1E-2", "1e-2", "0.02"},
+		{"99999999999999999999999999999999999999", "1", "100000000000000000000000000000000000000"},
+	}
+	for _, test := range tests {
+		if got := AddNumbers(test.a, test.b); got != test.want {
+			t.Error("for", test.a, "+", test.b, "expected", test.want, "got", got)
+		}
+	}
+}
+
+func TestCompareNumbers(t *testing.T) {
+	tests := []struct {
+		a, b dynamodbattribute.Number
+		want int
+	}{
+		{"1", "2", -1},
+		{"2", "1", 1},
+		{"1.0", "1", 0},
+		{"1e3", "1000", 0},
+		{"-1", "-2", 1},
+		{"-0", "0", 0},
+		{"0.30000000000000001", "0.3", 1},
+		{"1e-40", "0", 1},
+	}
+	for _, test := range tests {
+		if got := CompareNumbers(test.a, test.b); got != test.want {
+			t.Error("for", test.a, test.b, "expected", test.want, "got", got)
+		}
+	}
+}
+
+func TestNumberFunctionsPanicOnInvalid(t *testing.T) {
+	for _, n := range []dynamodbattribute.Number{"", "ten", "1..2", "0x10", "1/2"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic for", n)
+				}
+			}()
+			AddNumbers(n, "1")
+		}()
+	}
+}
+
+func TestNumberToInt(t *testing.T) {
+	tests := []struct {
+		n    dynamodbattribute.Number
+		want int
+		ok   bool
+	}{
+		{"42", 42, true},
+		{"-42", -42, true},
+		{"4.2e1", 42, true},
+		{"42.000", 42, true},
+		{"4.25", 0, false},
+		{"1e100", 0, false},
+	}
+	for _, test := range tests {
+		if got, ok := NumberToInt(test.n); got != test.want || ok != test.ok {
+			t.Error("for", test.n, "expected", test.want, test.ok, "got", got, ok)
+		}
+	}
+}
+
+func TestNumberToFloat(t *testing.T) {
+	tests := []struct {
+		n     dynamodbattribute.Number
+		want  float64
+		exact bool
+	}{
+		{"0.5", 0.5, true},
+		{"-2.5e2", -250, true},
+		{"0.1", 0.1, false},
+	}
+	for _, test := range tests {
+		if got, exact := NumberToFloat(test.n); got != test.want || exact != test.exact {
+			t.Error("for", test.n, "expected", test.want, test.exact, "got", got, exact)
+		}
+	}
+	if _, exact := NumberToFloat("1e400"); exact {
+		t.Error("expected a number too large for a float64 not to be exact")
+	}
+}
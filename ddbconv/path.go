@@ -0,0 +1,62 @@
+package ddbconv
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/expression"
+	"strconv"
+	"strings"
+)
+
+// Path builds a document path to a nested attribute, for use in update, condition, and projection expressions.
+// The path starts at the named top level attribute, followed by any number of elements,
+// each either a string map key or an int list index.
+// For example, Path("profile", "addresses", 0, "city") is the path profile.addresses[0].city.
+// Path will panic if an element is any other type, if a list index is negative,
+// or if a name or map key is empty or contains '.', '[', or ']'.
+func Path(name string, elems ...interface{}) expression.NameBuilder {
+	return expression.Name(PathString(name, elems...))
+}
+
+// PathString is like Path, but returns the document path as a string, such as profile.addresses[0].city.
+func PathString(name string, elems ...interface{}) string {
+	var path strings.Builder
+	path.WriteString(requirePathName(name))
+	for _, elem := range elems {
+		switch e := elem.(type) {
+		case string:
+			path.WriteByte('.')
+			path.WriteString(requirePathName(e))
+		case int:
+			if e < 0 {
+				panic(fmt.Sprintf("negative list index in document path: %d", e))
+			}
+			path.WriteByte('[')
+			path.WriteString(strconv.Itoa(e))
+			path.WriteByte(']')
+		default:
+			panic(fmt.Sprintf("document path element must be a string or int, not %T", elem))
+		}
+	}
+	return path.String()
+}
+
+// DottedPath builds a document path from a string of dot separated names, such as profile.address.city,
+// followed by any list indexes of the last name, as with Path.
+func DottedPath(dotted string, indexes ...int) expression.NameBuilder {
+	names := strings.Split(dotted, ".")
+	elems := make([]interface{}, 0, len(names)-1+len(indexes))
+	for _, name := range names[1:] {
+		elems = append(elems, name)
+	}
+	for _, index := range indexes {
+		elems = append(elems, index)
+	}
+	return Path(names[0], elems...)
+}
+
+func requirePathName(name string) string {
+	if name == "" || strings.ContainsAny(name, ".[]") {
+		panic(fmt.Sprintf("invalid name in document path: %q", name))
+	}
+	return name
+}
@@ -0,0 +1,105 @@
+// Package ddbmaptest provides helpers for testing types stored with ddbmap, without a DynamoDB table.
+package ddbmaptest
+
+import (
+	"fmt"
+	"github.com/shawnsmithdev/ddbmap"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// AssertRoundTrip marshals value into an item with ddbmap.MarshalItem, unmarshals it with an unmarshaller
+// from ddbmap.UnmarshallerForType(template), and reports a test error listing any differences.
+// Differences usually mean a field is unexported, skipped by a struct tag, or of a type that does not round trip.
+// The template and value should be of the same type, or value may be a pointer to that type.
+func AssertRoundTrip(t testing.TB, template, value interface{}) {
+	t.Helper()
+	assertRoundTrip(t, ddbmap.MarshalItem, ddbmap.UnmarshallerForType(template), value)
+}
+
+// AssertRoundTripConfig is like AssertRoundTrip, but marshals and unmarshals with the given table config,
+// so options such as NameMapper and ZeroValueBehavior are applied.
+func AssertRoundTripConfig(t testing.TB, tc ddbmap.TableConfig, template, value interface{}) {
+	t.Helper()
+	assertRoundTrip(t, tc.MarshalItem, tc.UnmarshallerForType(template), value)
+}
+
+func assertRoundTrip(t testing.TB, marshal ddbmap.ItemMarshaller, unmarshal ddbmap.ItemUnmarshaller,
+	value interface{}) {
+	t.Helper()
+	item, err := marshal(value)
+	if err != nil {
+		t.Errorf("cannot marshal %T: %v", value, err)
+		return
+	}
+	got, err := unmarshal(item)
+	if err != nil {
+		t.Errorf("cannot unmarshal %T from item %v: %v", value, item, err)
+		return
+	}
+	want := reflect.ValueOf(value)
+	if want.Kind() == reflect.Ptr && want.Type().Elem() == reflect.TypeOf(got) {
+		want = want.Elem()
+	}
+	if diffs := diff(want, reflect.ValueOf(got), ""); len(diffs) > 0 {
+		t.Errorf("%T does not round trip, item: %v\n%v", value, item, strings.Join(diffs, "\n"))
+	}
+}
+
+// diff returns a line for each field of want and got that differs, or a single line if they are not structs.
+// Values of a type with an Equal method, such as time.Time, are compared with it rather than field by field.
+func diff(want, got reflect.Value, path string) []string {
+	equal, hasEqual := equalMethod(want, got)
+	if hasEqual && equal {
+		return nil
+	}
+	if !hasEqual && want.IsValid() && got.IsValid() && want.Type() == got.Type() && want.Kind() == reflect.Struct {
+		var diffs []string
+		for i := 0; i < want.NumField(); i++ {
+			field := want.Type().Field(i)
+			diffs = append(diffs, diff(want.Field(i), got.Field(i), path+"."+field.Name)...)
+		}
+		return diffs
+	}
+	wantVal, gotVal := valueOf(want), valueOf(got)
+	if !hasEqual && reflect.DeepEqual(wantVal, gotVal) {
+		return nil
+	}
+	if path == "" {
+		path = "value"
+	} else {
+		path = strings.TrimPrefix(path, ".")
+	}
+	return []string{fmt.Sprintf("%v: want %#v, got %#v", path, wantVal, gotVal)}
+}
+
+// valueOf returns the value held by v, or nil if v is invalid.
+// Unexported struct fields are read with fmt, as their values cannot be returned as interfaces.
+func valueOf(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if !v.CanInterface() {
+		return fmt.Sprintf("%#v", v)
+	}
+	return v.Interface()
+}
+
+// equalMethod compares want and got with their Equal method, if their type has one like time.Time.Equal.
+// The ok result is false if they are not of the same type with such a method.
+func equalMethod(want, got reflect.Value) (equal, ok bool) {
+	if !want.IsValid() || !got.IsValid() || want.Type() != got.Type() || !want.CanInterface() || !got.CanInterface() {
+		return false, false
+	}
+	method := want.MethodByName("Equal")
+	if !method.IsValid() {
+		return false, false
+	}
+	methodType := method.Type()
+	if methodType.NumIn() != 1 || methodType.In(0) != want.Type() ||
+		methodType.NumOut() != 1 || methodType.Out(0).Kind() != reflect.Bool {
+		return false, false
+	}
+	return method.Call([]reflect.Value{got})[0].Bool(), true
+}
@@ -0,0 +1,50 @@
+package ddbmaptest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripper struct {
+	ID      string
+	Count   int
+	Created time.Time
+	Tags    []string
+	Skipped string `dynamodbav:"-"`
+}
+
+// recorder records test errors instead of failing the test.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertRoundTrip(t *testing.T) {
+	value := roundTripper{ID: "a", Count: 2, Created: time.Unix(1500000000, 0).UTC(), Tags: []string{"x", "y"}}
+	AssertRoundTrip(t, roundTripper{}, value)
+	AssertRoundTrip(t, roundTripper{}, &value)
+}
+
+func TestAssertRoundTripReportsLoss(t *testing.T) {
+	r := &recorder{TB: t}
+	AssertRoundTrip(r, roundTripper{}, roundTripper{ID: "a", Skipped: "lost"})
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], `Skipped: want "lost", got ""`) {
+		t.Fatalf("expected an error for the skipped field, got: %v", r.errors)
+	}
+}
+
+func TestAssertRoundTripTimeInLocalZone(t *testing.T) {
+	r := &recorder{TB: t}
+	AssertRoundTrip(r, roundTripper{}, roundTripper{ID: "a", Created: time.Now().Truncate(time.Second)})
+	if len(r.errors) > 0 {
+		t.Fatalf("expected no errors for an equal time, got: %v", r.errors)
+	}
+}
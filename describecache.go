@@ -0,0 +1,194 @@
+package ddbmap
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"strings"
+	"sync"
+	"time"
+)
+
+// describeCache holds table descriptions cached according to DescribeCacheTTL, shared by all maps.
+var describeCache = struct {
+	sync.Mutex
+	byTable map[describeCacheKey]cachedDescription
+}{byTable: make(map[describeCacheKey]cachedDescription)}
+
+type describeCacheKey struct {
+	region string
+	table  string
+}
+
+type cachedDescription struct {
+	table   *dynamodb.TableDescription
+	expires time.Time
+}
+
+// describeCacheKey returns the cache key of the table, which includes its region, from CacheRegion or the client.
+// The ok result is false if the region is unknown, in which case nothing is cached.
+func (d *DynamoMap) describeCacheKey() (key describeCacheKey, ok bool) {
+	key = describeCacheKey{table: d.TableName, region: d.CacheRegion}
+	if client, isClient := d.Client.(*dynamodb.Client); key.region == "" && isClient && client.Client != nil {
+		key.region = client.Config.Region
+	}
+	return key, key.region != ""
+}
+
+// cachedDescription returns the cached description of the table, if DescribeCacheTTL is set and it has not expired.
+func (d *DynamoMap) cachedDescription() (*dynamodb.TableDescription, bool) {
+	key, ok := d.describeCacheKey()
+	if d.DescribeCacheTTL <= 0 || !ok {
+		return nil, false
+	}
+	describeCache.Lock()
+	defer describeCache.Unlock()
+	cached, ok := describeCache.byTable[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(cached.expires) {
+		delete(describeCache.byTable, key)
+		return nil, false
+	}
+	d.debug("using cached table description")
+	return cached.table, true
+}
+
+// cacheDescription caches the given description of the table if DescribeCacheTTL is set,
+// unless the table is being created or deleted, or its region is unknown.
+func (d *DynamoMap) cacheDescription(table *dynamodb.TableDescription) {
+	key, ok := d.describeCacheKey()
+	if d.DescribeCacheTTL <= 0 || !ok || table == nil ||
+		table.TableStatus == dynamodb.TableStatusCreating || table.TableStatus == dynamodb.TableStatusDeleting {
+		return
+	}
+	describeCache.Lock()
+	defer describeCache.Unlock()
+	describeCache.byTable[key] = cachedDescription{
+		table:   table,
+		expires: time.Now().Add(d.DescribeCacheTTL),
+	}
+}
+
+// ClearDescribeCache removes any cached description of this table, as cached if DescribeCacheTTL is set,
+// and any cached key schema, so the table is described again the next time it is needed.
+// They are also cleared when a request to the table fails because it is not found, or because a key does not
+// match the key schema, such as after the table is deleted and created again with another key schema.
+func (d *DynamoMap) ClearDescribeCache() {
+	key, ok := d.describeCacheKey()
+	if !ok {
+		return
+	}
+	describeCache.Lock()
+	delete(describeCache.byTable, key)
+	describeCache.Unlock()
+	keySchemas.Lock()
+	delete(keySchemas.byTable, key)
+	keySchemas.Unlock()
+}
+
+// keySchemaErrorMessages are parts of the messages of validation errors from a key that does not match
+// the key schema of the table.
+var keySchemaErrorMessages = []string{
+	"key element does not match the schema",
+	"Missing the key",
+	"Type mismatch for key",
+	"required keys was not given a value",
+}
+
+// onRequestError clears the cached description and key schema of the table if a request failed because
+// the table was not found, or because a key did not match the key schema, as the table may have been deleted,
+// or created again with another key schema. Other errors, such as an invalid expression, do not clear them.
+func (d *DynamoMap) onRequestError(err error) {
+	if isStaleSchemaError(err) {
+		d.debug("clearing cached table description, error:", err)
+		d.ClearDescribeCache()
+	}
+}
+
+// isStaleSchemaError returns true if the error is from a missing table, or a key that does not match the schema.
+func isStaleSchemaError(err error) bool {
+	dynamoErr, ok := AsError(err)
+	if !ok {
+		return false
+	}
+	switch dynamoErr.Code {
+	case dynamodb.ErrCodeResourceNotFoundException, dynamodb.ErrCodeTableNotFoundException:
+		return true
+	case "ValidationException":
+		for _, message := range keySchemaErrorMessages {
+			if strings.Contains(dynamoErr.Message, message) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// keySchemas holds the key schema of each described table, shared by all maps. As the key schema of a table
+// cannot change, they are cached regardless of DescribeCacheTTL.
+var keySchemas = struct {
+	sync.Mutex
+	byTable map[describeCacheKey]KeySchema
+}{byTable: make(map[describeCacheKey]KeySchema)}
+
+// KeySchema describes the key attributes of a table, as read from the table description.
+type KeySchema struct {
+	// The name of the hash key attribute.
+	HashKeyName string
+	// The type of the hash key attribute.
+	HashKeyType dynamodb.ScalarAttributeType
+	// The name of the range key attribute, if any.
+	RangeKeyName string
+	// The type of the range key attribute, if any.
+	RangeKeyType dynamodb.ScalarAttributeType
+}
+
+// Ranged returns true if RangeKeyName is not empty.
+func (k KeySchema) Ranged() bool {
+	return k.RangeKeyName != ""
+}
+
+// KeySchema returns the names and types of the key attributes of the table, as described by DescribeTable,
+// such as to build keys for a table whose schema is not known in advance.
+// The key schema is cached after the table is first described, as it cannot change, unless the region
+// of the table is unknown. It is cleared by ClearDescribeCache, such as when the table is not found.
+func (d *DynamoMap) KeySchema() (KeySchema, error) {
+	key, cacheable := d.describeCacheKey()
+	var schema KeySchema
+	if cacheable {
+		keySchemas.Lock()
+		cachedSchema, ok := keySchemas.byTable[key]
+		keySchemas.Unlock()
+		if ok {
+			return cachedSchema, nil
+		}
+	}
+
+	table, cached := d.cachedDescription()
+	if !cached {
+		var err error
+		if table, err = d.describeTable(context.Background()); err != nil {
+			return KeySchema{}, err
+		}
+	}
+	types := make(map[string]dynamodb.ScalarAttributeType, len(table.AttributeDefinitions))
+	for _, attr := range table.AttributeDefinitions {
+		types[aws.StringValue(attr.AttributeName)] = attr.AttributeType
+	}
+	for _, element := range table.KeySchema {
+		name := aws.StringValue(element.AttributeName)
+		if element.KeyType == dynamodb.KeyTypeHash {
+			schema.HashKeyName, schema.HashKeyType = name, types[name]
+		} else {
+			schema.RangeKeyName, schema.RangeKeyType = name, types[name]
+		}
+	}
+	if cacheable {
+		keySchemas.Lock()
+		keySchemas.byTable[key] = schema
+		keySchemas.Unlock()
+	}
+	return schema, nil
+}
@@ -0,0 +1,59 @@
+package ddbmap
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbiface"
+	"testing"
+)
+
+// wrappedClient is a client whose region cannot be read.
+type wrappedClient struct {
+	dynamodbiface.ClientAPI
+}
+
+func TestDescribeCacheKeyRegion(t *testing.T) {
+	client, closeServer := fakeDynamo(t, func(string, []byte) interface{} { return nil })
+	defer closeServer()
+	tests := []struct {
+		name   string
+		d      *DynamoMap
+		region string
+		ok     bool
+	}{
+		{"client", &DynamoMap{Client: client}, "us-west-2", true},
+		{"wrapped", &DynamoMap{Client: wrappedClient{client}}, "", false},
+		{"configured", &DynamoMap{TableConfig: TableConfig{CacheRegion: "eu-west-1"}, Client: wrappedClient{client}},
+			"eu-west-1", true},
+	}
+	for _, test := range tests {
+		key, ok := test.d.describeCacheKey()
+		if key.region != test.region || ok != test.ok {
+			t.Error(test.name, "expected", test.region, test.ok, "got", key.region, ok)
+		}
+	}
+}
+
+func TestIsStaleSchemaError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{awserr.New(dynamodb.ErrCodeResourceNotFoundException, "Requested resource not found", nil), true},
+		{awserr.New("ValidationException", "The provided key element does not match the schema", nil), true},
+		{awserr.New("ValidationException", "One or more parameter values were invalid: Missing the key Id in the item",
+			nil), true},
+		{awserr.New("ValidationException", "One or more parameter values were invalid: Type mismatch for key Id "+
+			"expected: S actual: N", nil), true},
+		{awserr.New("ValidationException", "Item size has exceeded the maximum allowed size", nil), false},
+		{awserr.New("ValidationException", "Invalid UpdateExpression: Syntax error", nil), false},
+		{awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil), false},
+		{requestError("GetItem", nil, awserr.New(dynamodb.ErrCodeResourceNotFoundException, "not found", nil)), true},
+	}
+	for _, test := range tests {
+		if got := isStaleSchemaError(test.err); got != test.want {
+			t.Error("for", test.err, "expected", test.want, "got", got)
+		}
+	}
+}
@@ -3,26 +3,52 @@ package ddbmap // import "github.com/shawnsmithdev/ddbmap"
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbiface"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/expression"
 	"github.com/shawnsmithdev/ddbmap/ddbconv"
 	"golang.org/x/sync/errgroup"
 	"log"
+	"math/rand"
+	"strings"
+	"sync"
 	"time"
 )
 
 const (
-	// How long between checks while waiting for a newly created table to become usable.
-	creatingPollDuration = time.Second * 10
+	// DefaultPollInterval is the wait before first checking again on a table that is not yet usable,
+	// if PollInterval is not set.
+	DefaultPollInterval = time.Second
+	// DefaultMaxPollInterval is the longest wait between checks on a table that is not yet usable,
+	// if MaxPollInterval is not set.
+	DefaultMaxPollInterval = time.Second * 10
 	// DefaultTimeToLiveName is used if the TTL duration is set but the ttl attribute name is not.
 	DefaultTimeToLiveName = "TTL"
+	// MaxItemSize is the maximum size in bytes of a single DynamoDB item.
+	MaxItemSize = 400 * 1024
 )
 
 var (
 	// Indicates that a range operation consumer caused an early termination by returning false. Do not return it.
 	errEarlyTermination = fmt.Errorf("ddbmap early termination")
+	// Indicates that a scan with a time budget stopped before passing the current item to the consumer.
+	errBudgetSpent = errors.New("ddbmap scan budget spent")
+
+	// ErrItemTooLarge is returned when CheckItemSize is set and an item to store is larger than MaxItemSize.
+	// The returned error wraps ErrItemTooLarge and includes the measured size.
+	ErrItemTooLarge = errors.New("item too large")
+
+	// ErrItemNotFound is returned by LoadItemOrError when there is no item with the given key(s).
+	// The returned error wraps ErrItemNotFound and includes the key.
+	ErrItemNotFound = errors.New("item not found")
+
+	// ErrTimeToLiveNameRequired is returned when RequireTimeToLiveName is true and TimeToLiveDuration is set,
+	// but TimeToLiveName is empty.
+	ErrTimeToLiveNameRequired = errors.New("time to live name is required")
 
 	// interface checks
 	_ Map     = &DynamoMap{}
@@ -32,7 +58,64 @@ var (
 // DynamoMap is a map view of a DynamoDB table. *DynamoMap implements both Map and ItemMap.
 type DynamoMap struct {
 	TableConfig
-	Client *dynamodb.Client
+	// Client is used for all requests, other than reads if ReadClient is set.
+	// NewMap sets it to a *dynamodb.Client, but any implementation may be used, such as a wrapper for logging.
+	Client dynamodbiface.ClientAPI
+	// ReadClient, if not nil, is used instead of Client to load, scan, and query items,
+	// such as to read from the replica of a global table in a specific region,
+	// or through a DynamoDB Accelerator (DAX) client that implements dynamodbiface.ClientAPI.
+	ReadClient dynamodbiface.ClientAPI
+	// true if NewMap created the table
+	createdTable bool
+}
+
+// CreatedTable returns true if the table did not exist and was created by NewMap,
+// such as to seed a new table with data. It returns false if the table already existed.
+func (d *DynamoMap) CreatedTable() bool {
+	return d.createdTable
+}
+
+// WithReadClient returns a copy of this map that reads items using a client created from the given config,
+// such as one with a different Region or endpoint, and writes items using the same client as this map.
+func (d *DynamoMap) WithReadClient(cfg aws.Config) *DynamoMap {
+	result := *d
+	result.ReadClient = dynamodb.New(cfg)
+	return &result
+}
+
+// WithTable returns a copy of this map that uses the named table, with the same clients and configuration,
+// such as to route requests to one of several sharded tables with the same key schema.
+// The named table must already exist, as it is not described or created.
+func (d *DynamoMap) WithTable(name string) *DynamoMap {
+	result := *d
+	result.TableName = name
+	return &result
+}
+
+// Close flushes and closes any open buffered writers created from this map, and releases any other resources
+// held by this map. It returns the first error from closing a writer, if any.
+// The map should not be used after it is closed.
+func (d *DynamoMap) Close() error {
+	bufferedWriters.Lock()
+	writers := bufferedWriters.byMap[d]
+	delete(bufferedWriters.byMap, d)
+	bufferedWriters.Unlock()
+
+	var result error
+	for _, w := range writers {
+		if err := w.Close(context.Background()); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// reader returns the client used to read items.
+func (d *DynamoMap) reader() dynamodbiface.ClientAPI {
+	if d.ReadClient == nil {
+		return d.Client
+	}
+	return d.ReadClient
 }
 
 func (d *DynamoMap) log(vals ...interface{}) {
@@ -49,17 +132,49 @@ func (d *DynamoMap) forbidErr(err error) {
 	forbidErr(err, d.log)
 }
 
+// dryRun logs the input of a request that would modify items, returning true if it should be skipped.
+func (d *DynamoMap) dryRun(op string, input interface{}) bool {
+	if d.DryRun {
+		d.log("dry run, skipping", op, "request input:", input)
+	}
+	return d.DryRun
+}
+
 func (d *DynamoMap) debug(vals ...interface{}) {
 	if d.Debug {
 		d.log(vals...)
 	}
 }
 
+// encodeItem applies any configured attribute codecs, then any field encryption, to an item about to be stored.
+func (d *DynamoMap) encodeItem(item Item) (Item, error) {
+	item, err := applyCodecs(item, d.AttributeCodecs, true)
+	if err != nil {
+		return nil, err
+	}
+	return d.encryptFields(item)
+}
+
+// decodeItem reverses any configured field encryption, then any attribute codecs, on a loaded item.
+func (d *DynamoMap) decodeItem(item Item) (Item, error) {
+	item, err := d.decryptFields(item)
+	if err != nil {
+		return nil, err
+	}
+	return applyCodecs(item, d.AttributeCodecs, false)
+}
+
 func (d *DynamoMap) unmarshalValue(item Item) interface{} {
-	if d.ValueUnmarshaller == nil {
+	var result interface{}
+	var err error
+	switch {
+	case d.KeyValueUnmarshaller != nil:
+		result, err = d.KeyValueUnmarshaller(d.ToKeyItem(item), item)
+	case d.ValueUnmarshaller != nil:
+		result, err = d.ValueUnmarshaller(item)
+	default:
 		return item
 	}
-	result, err := d.ValueUnmarshaller(item)
 	d.forbidErr(err)
 	return result
 }
@@ -69,35 +184,40 @@ func (d *DynamoMap) unmarshalValue(item Item) interface{} {
 // If the table does not exist, the status will be empty.
 // If setKeys is true, the keys will be set using the table description.
 func (d *DynamoMap) DescribeTable(setKeys bool) (status dynamodb.TableStatus, err error) {
-	input := &dynamodb.DescribeTableInput{TableName: &d.TableName}
-	var dtResp *dynamodb.DescribeTableResponse
+	return d.DescribeTableWithContext(context.Background(), setKeys)
+}
 
-	for {
-		d.debug("describe table request input:", input)
-		dtReq := d.Client.DescribeTableRequest(input)
-		dtResp, err = dtReq.Send(context.Background())
-		d.debug("describe table response:", dtResp, ", error:", err)
-		if err != nil {
-			if dynamodb.ErrCodeResourceNotFoundException == getErrCode(err) {
-				return "", nil
+// DescribeTableWithContext is like DescribeTable, but stops waiting and returns the context error
+// if the context is done while the table is CREATING.
+func (d *DynamoMap) DescribeTableWithContext(ctx context.Context, setKeys bool) (status dynamodb.TableStatus,
+	err error) {
+	for attempt := 0; ; attempt++ {
+		table, cached := d.cachedDescription()
+		if !cached {
+			if table, err = d.describeTable(ctx); err != nil {
+				if dynamodb.ErrCodeResourceNotFoundException == getErrCode(err) {
+					return "", nil
+				}
+				return "", err
 			}
-			return "", err
 		}
 
-		status = dtResp.Table.TableStatus
+		status = table.TableStatus
 		d.debug("table status:", status)
 
 		switch status {
 		case dynamodb.TableStatusCreating: // Wait for creating
 			d.log("waiting for status:", status)
-			time.Sleep(creatingPollDuration)
+			if err = d.pollWait(ctx, attempt); err != nil {
+				return status, err
+			}
 			continue
 		case dynamodb.TableStatusDeleting: // Give up if deleting
 			d.log("cannot use table being deleted")
 			return status, fmt.Errorf("cannot use table being deleted")
 		default: // Table usable, check key names
 			if setKeys {
-				for _, keySchema := range dtResp.Table.KeySchema {
+				for _, keySchema := range table.KeySchema {
 					if keySchema.KeyType == dynamodb.KeyTypeHash {
 						d.HashKeyName = *keySchema.AttributeName
 						d.debug("found hash key:", d.HashKeyName)
@@ -112,6 +232,27 @@ func (d *DynamoMap) DescribeTable(setKeys bool) (status dynamodb.TableStatus, er
 	}
 }
 
+// pollWait waits before checking again on a table that is not yet usable, returning early if the context is done.
+// The wait starts at PollInterval and doubles with each attempt up to MaxPollInterval,
+// with random jitter of up to half the wait.
+func (d *DynamoMap) pollWait(ctx context.Context, attempt int) error {
+	wait, max := d.PollInterval, d.MaxPollInterval
+	if wait <= 0 {
+		wait = DefaultPollInterval
+	}
+	if max <= 0 {
+		max = DefaultMaxPollInterval
+	}
+	for ; attempt > 0 && wait < max; attempt-- {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+	wait -= time.Duration(rand.Int63n(int64(wait)/2 + 1))
+	return sleepContext(ctx, wait)
+}
+
 // CreateTable creates a new table.
 func (d *DynamoMap) CreateTable() error {
 	schema := []dynamodb.KeySchemaElement{
@@ -132,142 +273,385 @@ func (d *DynamoMap) CreateTable() error {
 	if d.CreateTableWriteCapacity < 1 {
 		d.CreateTableWriteCapacity = 1
 	}
+	throughput := &dynamodb.ProvisionedThroughput{
+		ReadCapacityUnits:  aws.Int64(int64(d.CreateTableReadCapacity)),
+		WriteCapacityUnits: aws.Int64(int64(d.CreateTableWriteCapacity)),
+	}
+	var indexes []dynamodb.GlobalSecondaryIndex
+	for i := range d.GlobalSecondaryIndexes {
+		spec := &d.GlobalSecondaryIndexes[i]
+		index := dynamodb.GlobalSecondaryIndex{
+			IndexName: &spec.IndexName,
+			KeySchema: []dynamodb.KeySchemaElement{
+				{AttributeName: &spec.HashKeyName, KeyType: dynamodb.KeyTypeHash},
+			},
+			Projection: &dynamodb.Projection{
+				ProjectionType:   spec.ProjectionType,
+				NonKeyAttributes: spec.NonKeyAttributes,
+			},
+			ProvisionedThroughput: throughput,
+		}
+		if index.Projection.ProjectionType == "" {
+			index.Projection.ProjectionType = dynamodb.ProjectionTypeAll
+		}
+		attrs = addAttributeDefinition(attrs, &spec.HashKeyName, spec.HashKeyType)
+		if spec.RangeKeyName != "" {
+			index.KeySchema = append(index.KeySchema,
+				dynamodb.KeySchemaElement{AttributeName: &spec.RangeKeyName, KeyType: dynamodb.KeyTypeRange})
+			attrs = addAttributeDefinition(attrs, &spec.RangeKeyName, spec.RangeKeyType)
+		}
+		indexes = append(indexes, index)
+	}
 	input := &dynamodb.CreateTableInput{
-		TableName:            &d.TableName,
-		KeySchema:            schema,
-		AttributeDefinitions: attrs,
-		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
-			ReadCapacityUnits:  aws.Int64(int64(d.CreateTableReadCapacity)),
-			WriteCapacityUnits: aws.Int64(int64(d.CreateTableWriteCapacity)),
-		},
+		TableName:              &d.TableName,
+		KeySchema:              schema,
+		AttributeDefinitions:   attrs,
+		GlobalSecondaryIndexes: indexes,
+		ProvisionedThroughput:  throughput,
 		SSESpecification: &dynamodb.SSESpecification{
 			Enabled: aws.Bool(d.ServerSideEncryption),
 		},
 	}
 	d.debug("create table request input:", input)
-	resp, err := d.Client.CreateTableRequest(input).Send(context.Background())
+	req := d.Client.CreateTableRequest(input)
+	sendCtx, end := d.startSpan(context.Background(), "CreateTable", nil)
+	resp, err := req.Send(sendCtx)
+	err = requestError("CreateTable", req.Request, err)
+	end(err)
 	d.debug("created table response:", resp, ", error:", err)
+	d.ClearDescribeCache()
 	return err
 }
 
+// addAttributeDefinition adds an attribute definition if the attribute is not already defined.
+func addAttributeDefinition(attrs []dynamodb.AttributeDefinition, name *string,
+	attrType dynamodb.ScalarAttributeType) []dynamodb.AttributeDefinition {
+	for _, attr := range attrs {
+		if *attr.AttributeName == *name {
+			return attrs
+		}
+	}
+	return append(attrs, dynamodb.AttributeDefinition{AttributeName: name, AttributeType: attrType})
+}
+
 func (d *DynamoMap) descTTL() (*dynamodb.DescribeTimeToLiveResponse, error) {
 	descInput := &dynamodb.DescribeTimeToLiveInput{TableName: &d.TableName}
 	d.debug("describe ttl request input:", descInput)
-	descResp, err := d.Client.DescribeTimeToLiveRequest(descInput).Send(context.Background())
+	req := d.Client.DescribeTimeToLiveRequest(descInput)
+	sendCtx, end := d.startSpan(context.Background(), "DescribeTimeToLive", nil)
+	descResp, err := req.Send(sendCtx)
+	err = requestError("DescribeTimeToLive", req.Request, err)
+	end(err)
 	d.debug("describe ttl response:", descResp, ", error:", err)
 	return descResp, err
 }
 
 func (d *DynamoMap) updateTTL(enabled bool) error {
-	if d.TimeToLiveName == "" {
-		d.TimeToLiveName = DefaultTimeToLiveName
-	}
 	updateInput := &dynamodb.UpdateTimeToLiveInput{
 		TableName: &d.TableName,
 		TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
-			AttributeName: &d.TimeToLiveName,
+			AttributeName: aws.String(d.TTLName()),
 			Enabled:       &enabled,
 		},
 	}
 	d.debug("update ttl request input:", updateInput)
-	updateResp, err := d.Client.UpdateTimeToLiveRequest(updateInput).Send(context.Background())
+	req := d.Client.UpdateTimeToLiveRequest(updateInput)
+	sendCtx, end := d.startSpan(context.Background(), "UpdateTimeToLive", nil)
+	updateResp, err := req.Send(sendCtx)
+	err = requestError("UpdateTimeToLive", req.Request, err)
+	end(err)
 	d.debug("update ttl response:", updateResp, ", error:", err)
 	return err
 }
 
+// TTLChange describes the TimeToLive configuration of a table before and after EnableTTL or DisableTTL.
+type TTLChange struct {
+	// The TimeToLive status before the call.
+	Before dynamodb.TimeToLiveStatus
+	// The TimeToLive status after the call, which is ENABLING or DISABLING if it was changed.
+	After dynamodb.TimeToLiveStatus
+	// The name of the time to live attribute before the call, if any.
+	BeforeAttributeName string
+	// The name of the time to live attribute after the call, if any.
+	AttributeName string
+}
+
+// Changed returns true if the TimeToLive status or attribute name was changed.
+func (c TTLChange) Changed() bool {
+	return c.Before != c.After || c.BeforeAttributeName != c.AttributeName
+}
+
+// describeTTLChange returns a TTLChange with the current TimeToLive configuration as both before and after.
+func (d *DynamoMap) describeTTLChange() (TTLChange, error) {
+	descResp, err := d.descTTL()
+	if err != nil {
+		return TTLChange{}, err
+	}
+	var change TTLChange
+	if desc := descResp.TimeToLiveDescription; desc != nil {
+		change.Before = desc.TimeToLiveStatus
+		change.BeforeAttributeName = aws.StringValue(desc.AttributeName)
+	}
+	change.After, change.AttributeName = change.Before, change.BeforeAttributeName
+	return change, nil
+}
+
 // EnableTTL will enable TimeToLive on the table if it is not enabled,
 // or update it if the configured time to live attribute name does not match the one currently in use.
-func (d *DynamoMap) EnableTTL() error {
+// It returns the TimeToLive configuration before and after, which are the same if nothing was changed.
+// If TimeToLiveDuration is not set, nothing is done and the change is empty.
+func (d *DynamoMap) EnableTTL() (TTLChange, error) {
 	if d.TimeToLiveDuration <= 0 {
-		return nil
+		return TTLChange{}, nil
 	}
-	descResp, err := d.descTTL()
+	if err := d.Validate(); err != nil {
+		return TTLChange{}, err
+	}
+	change, err := d.describeTTLChange()
 	if err != nil {
-		return err
+		return change, err
 	}
-	switch descResp.TimeToLiveDescription.TimeToLiveStatus {
+	update := false
+	switch change.Before {
 	case dynamodb.TimeToLiveStatusEnabled:
-		ttlName := *descResp.TimeToLiveDescription.AttributeName
-		if !(ttlName == d.TimeToLiveName || (ttlName == DefaultTimeToLiveName && d.TimeToLiveName == "")) {
-			d.log("Will update Time To Live attribute, was:", ttlName)
-			err = d.updateTTL(true)
+		if change.BeforeAttributeName != d.TTLName() {
+			d.log("Will update Time To Live attribute, was:", change.BeforeAttributeName)
+			update = true
 		}
 	case dynamodb.TimeToLiveStatusDisabled:
-		err = d.updateTTL(true)
+		update = true
 	case dynamodb.TimeToLiveStatusDisabling:
 		d.log("Cannot enable ttl when status is DISABLING, doing nothing")
 	}
-	return err
+	if update {
+		if err = d.updateTTL(true); err == nil {
+			change.After, change.AttributeName = dynamodb.TimeToLiveStatusEnabling, d.TTLName()
+		}
+	}
+	return change, err
 }
 
 // DisableTTL will disable TimeToLive on the table if it is enabled.
-func (d *DynamoMap) DisableTTL() error {
-	descResp, err := d.descTTL()
+// It returns the TimeToLive configuration before and after, which are the same if nothing was changed.
+func (d *DynamoMap) DisableTTL() (TTLChange, error) {
+	change, err := d.describeTTLChange()
 	if err != nil {
-		return err
+		return change, err
 	}
-	switch descResp.TimeToLiveDescription.TimeToLiveStatus {
+	switch change.Before {
 	case dynamodb.TimeToLiveStatusEnabled:
-		err = d.updateTTL(false)
+		if err = d.updateTTL(false); err == nil {
+			change.After = dynamodb.TimeToLiveStatusDisabling
+		}
 	case dynamodb.TimeToLiveStatusEnabling:
 		d.log("Cannot disable ttl when status is ENABLING, doing nothing")
 	}
-	return err
+	return change, err
 }
 
-func (d *DynamoMap) delete(item Item) error {
+// WaitForTTL polls the TimeToLive status of the table until it is ENABLED, if enabled is true, or DISABLED if not,
+// such as to wait for a change made by EnableTTL or DisableTTL to take effect, which can take up to an hour.
+// Polling backs off as configured by PollInterval and MaxPollInterval.
+// Returns an error wrapping context.DeadlineExceeded if the status has not changed after the timeout.
+func (d *DynamoMap) WaitForTTL(enabled bool, timeout time.Duration) error {
+	want := dynamodb.TimeToLiveStatusDisabled
+	if enabled {
+		want = dynamodb.TimeToLiveStatusEnabled
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for attempt := 0; ; attempt++ {
+		change, err := d.describeTTLChange()
+		if err != nil {
+			return err
+		}
+		if change.After == want {
+			return nil
+		}
+		d.log("waiting for ttl status:", want, ", was:", change.After)
+		if err = d.pollWait(ctx, attempt); err != nil {
+			return fmt.Errorf("ttl status %v, not %v: %w", change.After, want, err)
+		}
+	}
+}
+
+func (d *DynamoMap) delete(ctx context.Context, item Item, returnValues dynamodb.ReturnValue) (Item, error) {
 	input := &dynamodb.DeleteItemInput{
-		TableName: &d.TableName,
-		Key:       d.ToKeyItem(item),
+		TableName:              &d.TableName,
+		Key:                    d.ToKeyItem(item),
+		ReturnValues:           returnValues,
+		ReturnConsumedCapacity: d.returnCapacity(),
+	}
+	if d.dryRun("delete", input) {
+		return nil, nil
 	}
 	d.debug("delete request input:", input)
-	resp, err := d.Client.DeleteItemRequest(input).Send(context.Background())
+	req := d.Client.DeleteItemRequest(input)
+	sendCtx, end := d.startSpan(ctx, "DeleteItem", input.Key)
+	resp, err := req.Send(sendCtx)
+	err = requestError("DeleteItem", req.Request, err)
+	d.onRequestError(err)
+	end(err)
 	d.debug("delete response:", resp, ", error:", err)
-	return err
+	if err != nil {
+		return nil, err
+	}
+	d.reportCapacityOf("delete", resp.ConsumedCapacity)
+	return d.decodeItem(resp.Attributes)
 }
 
 // DeleteItem deletes any existing item with the same key(s) as the given item.
 func (d *DynamoMap) DeleteItem(key Itemable) error {
-	return d.delete(key.AsItem())
+	_, err := d.delete(context.Background(), key.AsItem(), "")
+	return err
+}
+
+// DeleteItemWithContext is like DeleteItem, but sends the request with the given context,
+// such as to cancel it or to trace it with a Tracer.
+func (d *DynamoMap) DeleteItemWithContext(ctx context.Context, key Itemable) error {
+	_, err := d.delete(ctx, key.AsItem(), "")
+	return err
+}
+
+// DeleteItemReturningOld deletes any existing item with the same key(s) as the given item,
+// returning the deleted item, and true if there was one.
+// In dry run mode, nothing is deleted and existed is always false.
+func (d *DynamoMap) DeleteItemReturningOld(key Itemable) (old Item, existed bool, err error) {
+	old, err = d.delete(context.Background(), key.AsItem(), dynamodb.ReturnValueAllOld)
+	return old, err == nil && len(old) > 0, err
 }
 
 // Delete delete the value stored under the same key(s) as the given value, if any.
 func (d *DynamoMap) Delete(key interface{}) (err error) {
-	if item, err := MarshalItem(key); err == nil {
-		return d.delete(item)
+	if item, err := d.MarshalItem(key); err == nil {
+		_, err = d.delete(context.Background(), item, "")
+		return err
 	}
 	return err
 }
 
-func (d *DynamoMap) load(key Item) (value Item, ok bool, err error) {
+func (d *DynamoMap) load(ctx context.Context, key Item) (value Item, ok bool, err error) {
+	return d.loadProjected(ctx, key, nil)
+}
+
+// loadProjected loads the item with the key(s) of the given item.
+// If projection is not nil, only the projected attributes are read.
+func (d *DynamoMap) loadProjected(ctx context.Context, key Item,
+	projection *expression.ProjectionBuilder) (value Item, ok bool, err error) {
 	input := &dynamodb.GetItemInput{
-		TableName:      &d.TableName,
-		ConsistentRead: &d.ReadWithStrongConsistency,
-		Key:            d.ToKeyItem(key),
+		TableName:              &d.TableName,
+		ConsistentRead:         &d.ReadWithStrongConsistency,
+		Key:                    d.ToKeyItem(key),
+		ReturnConsumedCapacity: d.returnCapacity(),
+	}
+	if projection != nil {
+		expr, err := expression.NewBuilder().WithProjection(*projection).Build()
+		if err != nil {
+			return nil, false, err
+		}
+		input.ProjectionExpression = expr.Projection()
+		input.ExpressionAttributeNames = expr.Names()
+	}
+	resp, err := d.getItem(ctx, input)
+	if err != nil && d.FallbackToEventualOnThrottle && aws.BoolValue(input.ConsistentRead) &&
+		dynamodb.ErrCodeProvisionedThroughputExceededException == getErrCode(err) {
+		d.debug("strongly consistent load throttled, retrying with an eventually consistent read")
+		input.ConsistentRead = aws.Bool(false)
+		resp, err = d.getItem(ctx, input)
+	}
+	if err != nil {
+		return nil, false, err
 	}
+	if len(resp.Item) == 0 {
+		return nil, false, nil
+	}
+	if value, err = d.decodeItem(resp.Item); err == nil && projection == nil {
+		err = d.checkBuiltKeys(value)
+	}
+	return value, err == nil, err
+}
+
+// getItem sends a GetItem request.
+func (d *DynamoMap) getItem(ctx context.Context, input *dynamodb.GetItemInput) (*dynamodb.GetItemResponse, error) {
 	d.debug("load request input:", input)
-	resp, err := d.Client.GetItemRequest(input).Send(context.Background())
+	req := d.reader().GetItemRequest(input)
+	sendCtx, end := d.startSpan(ctx, "GetItem", input.Key)
+	resp, err := req.Send(sendCtx)
+	err = requestError("GetItem", req.Request, err)
+	d.onRequestError(err)
+	end(err)
 	d.debug("load response:", resp, ", error:", err)
-	if err == nil {
-		return resp.Item, len(resp.Item) > 0, err
+	if err != nil {
+		return nil, err
 	}
-	return nil, false, err
+	d.reportCapacityOf("load", resp.ConsumedCapacity)
+	return resp, nil
 }
 
 // LoadItem returns the existing item, if present, with the same key(s) as the given item.
 // The ok result returns true if the value was found.
 func (d *DynamoMap) LoadItem(key Itemable) (item Item, ok bool, err error) {
-	return d.load(key.AsItem())
+	return d.load(context.Background(), key.AsItem())
+}
+
+// LoadItemWithContext is like LoadItem, but sends the request with the given context,
+// such as to cancel it or to trace it with a Tracer.
+func (d *DynamoMap) LoadItemWithContext(ctx context.Context, key Itemable) (item Item, ok bool, err error) {
+	return d.load(ctx, key.AsItem())
+}
+
+// LoadAttribute returns the value of a single attribute of the stored item with the same key(s) as the given key,
+// reading only that attribute, which consumes less read capacity than loading a large item.
+// An attribute may be a dot separated path into nested maps, such as profile.name.
+// The ok result is false if there is no such item, or if it does not have the attribute.
+func (d *DynamoMap) LoadAttribute(key Itemable, attr string) (val dynamodb.AttributeValue, ok bool, err error) {
+	projection := expression.NamesList(expression.Name(attr))
+	item, ok, err := d.loadProjected(context.Background(), key.AsItem(), &projection)
+	if !ok || err != nil {
+		return val, false, err
+	}
+	val = dynamodb.AttributeValue{M: item}
+	for _, name := range strings.Split(attr, ".") {
+		if val, ok = val.M[name]; !ok {
+			return val, false, nil
+		}
+	}
+	return val, true, nil
+}
+
+// LoadItemOrError returns the existing item, if present, with the same key(s) as the given item.
+// If there is no such item, it returns an error that wraps ErrItemNotFound, which can be checked with errors.Is.
+func (d *DynamoMap) LoadItemOrError(key Itemable) (Item, error) {
+	keyItem := key.AsItem()
+	item, ok, err := d.load(context.Background(), keyItem)
+	if err == nil && !ok {
+		err = fmt.Errorf("%w: %v", ErrItemNotFound, d.ToKeyItem(keyItem))
+	}
+	return item, err
+}
+
+// LoadItemInto loads the existing item, if present, with the same key(s) as the given item,
+// and unmarshals it into dest, which must be a pointer, using UnmarshalItem.
+// The ok result returns true if the item was found. If not, dest is unchanged.
+func (d *DynamoMap) LoadItemInto(key Itemable, dest interface{}) (ok bool, err error) {
+	item, ok, err := d.load(context.Background(), key.AsItem())
+	if !ok || err != nil {
+		return false, err
+	}
+	if err = d.UnmarshalItem(item, dest); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // Load returns any value stored under the same key(s) as the given value, if any.
 // The ok result indicates if there a value was found for the key.
 func (d *DynamoMap) Load(key interface{}) (value interface{}, ok bool, err error) {
-	keyItem, err := MarshalItem(key)
+	keyItem, err := d.MarshalItem(key)
 	if err != nil {
 		return nil, false, err
 	}
-	resultItem, ok, err := d.load(keyItem)
+	resultItem, ok, err := d.load(context.Background(), keyItem)
 	if err != nil {
 		return nil, false, err
 	}
@@ -275,83 +659,193 @@ func (d *DynamoMap) Load(key interface{}) (value interface{}, ok bool, err error
 	return value, ok, nil
 }
 
-func (d *DynamoMap) store(item Item, condition *expression.ConditionBuilder) error {
-	input := &dynamodb.PutItemInput{
-		TableName: &d.TableName,
-		Item:      item,
+// prepareItem checks and transforms a copy of an item to be stored, as configured, so the given item is unchanged.
+// If withTTL is true and TimeToLiveDuration is set, the TTL attribute is also added.
+// The UpdatedAtName attribute is set, as is the CreatedAtName attribute if the item does not have it,
+// or if isNew is true, as when the item is only stored if there is no existing item.
+func (d *DynamoMap) prepareItem(item Item, withTTL, isNew bool) (Item, error) {
+	copied := make(Item, len(item)+3)
+	for name, av := range item {
+		copied[name] = av
 	}
-	if condition != nil {
-		condExpr, err := expression.NewBuilder().WithCondition(*condition).Build()
-		if err != nil {
-			return err
+	item, err := d.buildKeys(copied, true)
+	if err != nil {
+		return nil, err
+	}
+	if item, err = d.checkKeyTypes(item); err != nil {
+		return nil, err
+	}
+	if item, err = d.encodeItem(item); err != nil {
+		return nil, err
+	}
+	now := d.now()
+	if withTTL && d.TimeToLiveDuration > 0 {
+		if err = d.Validate(); err != nil {
+			return nil, err
 		}
-		input.ExpressionAttributeNames = condExpr.Names()
-		input.ExpressionAttributeValues = condExpr.Values()
-		input.ConditionExpression = condExpr.Condition()
-	}
-	if d.TimeToLiveDuration > 0 {
-		ttl := ddbconv.EncodeInt(int(time.Now().Add(d.TimeToLiveDuration).Unix()))
-		if "" == d.TimeToLiveName {
-			input.Item[DefaultTimeToLiveName] = ttl
-		} else {
-			input.Item[d.TimeToLiveName] = ttl
+		item[d.TTLName()] = ddbconv.EncodeInt(int(now.Add(d.TimeToLiveDuration).Unix()))
+	}
+	if d.UpdatedAtName != "" {
+		item[d.UpdatedAtName] = ddbconv.EncodeInt64(now.Unix())
+	}
+	if d.CreatedAtName != "" && (isNew || !item.Exists(d.CreatedAtName)) {
+		item[d.CreatedAtName] = ddbconv.EncodeInt64(now.Unix())
+	}
+	if d.CheckItemSize {
+		if size := item.Size(); size > MaxItemSize {
+			d.debug("item too large, size:", size)
+			return nil, fmt.Errorf("%w: %d bytes, max %d bytes", ErrItemTooLarge, size, MaxItemSize)
 		}
 	}
+	return item, nil
+}
+
+func (d *DynamoMap) store(ctx context.Context, item Item, condition *builtCondition, withTTL, isNew bool) error {
+	item, err := d.prepareItem(item, withTTL, isNew)
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.PutItemInput{
+		TableName:              &d.TableName,
+		Item:                   item,
+		ReturnConsumedCapacity: d.returnCapacity(),
+	}
+	if condition != nil {
+		input.ExpressionAttributeNames = condition.names
+		input.ExpressionAttributeValues = condition.values
+		input.ConditionExpression = condition.expression
+	}
+	if d.dryRun("store", input) {
+		return nil
+	}
 	d.debug("store request input:", input)
-	resp, err := d.Client.PutItemRequest(input).Send(context.Background())
+	req := d.Client.PutItemRequest(input)
+	sendCtx, end := d.startSpan(ctx, "PutItem", d.ToKeyItem(item))
+	resp, err := req.Send(sendCtx)
+	err = requestError("PutItem", req.Request, err)
+	d.onRequestError(err)
+	end(err)
 	d.debug("store response:", resp, ", error:", err)
+	if err == nil {
+		d.reportCapacityOf("store", resp.ConsumedCapacity)
+	}
 	return err
 }
 
 // StoreItem stores the given item, clobbering any existing item with the same key(s).
 func (d *DynamoMap) StoreItem(val Itemable) error {
-	return d.store(val.AsItem(), nil)
+	return d.store(context.Background(), val.AsItem(), nil, true, false)
+}
+
+// StoreItemWithContext is like StoreItem, but sends the request with the given context,
+// such as to cancel it or to trace it with a Tracer.
+func (d *DynamoMap) StoreItemWithContext(ctx context.Context, val Itemable) error {
+	return d.store(ctx, val.AsItem(), nil, true, false)
+}
+
+// StoreItemNoTTL stores the given item, clobbering any existing item with the same key(s),
+// without adding the time to live attribute, so the item does not expire even if TimeToLiveDuration is set.
+// Any time to live attribute already in the given item is stored as is.
+func (d *DynamoMap) StoreItemNoTTL(val Itemable) error {
+	return d.store(context.Background(), val.AsItem(), nil, false, false)
 }
 
 // Store stores the given value. The first argument is ignored.
 func (d *DynamoMap) Store(val interface{}) (err error) {
-	if valItem, err := MarshalItem(val); err == nil {
-		return d.store(valItem, nil)
+	if valItem, err := d.MarshalItem(val); err == nil {
+		return d.store(context.Background(), valItem, nil, true, false)
 	}
 	return err
 }
 
-func (d *DynamoMap) storeItemIfAbsent(item Item) (stored bool, err error) {
-	noKey := expression.Name(d.HashKeyName).AttributeNotExists()
-	err = d.store(item, &noKey)
-	if err == nil {
-		return true, nil
+// storeIf stores the item if the condition is true, returning false without error if the condition failed.
+func (d *DynamoMap) storeIf(ctx context.Context, item Item, condition expression.ConditionBuilder) (stored bool, err error) {
+	built, err := buildCondition(condition)
+	if err != nil {
+		return false, err
 	}
-	if dynamodb.ErrCodeConditionalCheckFailedException != getErrCode(err) {
+	return d.storeIfBuilt(ctx, item, built)
+}
+
+// storeIfBuilt is storeIf with a condition that is already built, such as a cached condition.
+func (d *DynamoMap) storeIfBuilt(ctx context.Context, item Item, condition *builtCondition) (stored bool, err error) {
+	return d.storeIfBuiltNew(ctx, item, condition, false)
+}
+
+// storeIfBuiltNew is storeIfBuilt, also setting any CreatedAtName attribute to the current time if isNew is true.
+func (d *DynamoMap) storeIfBuiltNew(ctx context.Context, item Item, condition *builtCondition,
+	isNew bool) (stored bool, err error) {
+	err = d.store(ctx, item, condition, true, isNew)
+	if dynamodb.ErrCodeConditionalCheckFailedException == getErrCode(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// storeItemIfAbsent uses attribute_not_exists on the hash key even for ranged tables, as DynamoDB evaluates the
+// condition only against an existing item with the same full key (hash and range), if any.
+// Items with the same hash key and a different range key do not affect the result.
+// Any CreatedAtName attribute is set to the current time, as only a new item is stored.
+func (d *DynamoMap) storeItemIfAbsent(ctx context.Context, item Item) (stored bool, err error) {
+	condition, err := d.absentCondition()
+	if err != nil {
 		return false, err
 	}
-	return false, nil
+	return d.storeIfBuiltNew(ctx, item, condition, true)
 }
 
 // StoreItemIfAbsent stores the given item if there is no existing item with the same key(s),
-// returning true if stored.
+// returning true if stored. For ranged tables, both the hash and range key must match an existing item.
 func (d *DynamoMap) StoreItemIfAbsent(val Itemable) (stored bool, err error) {
-	return d.storeItemIfAbsent(val.AsItem())
+	return d.storeItemIfAbsent(context.Background(), val.AsItem())
 }
 
 // StoreIfAbsent stores the given value if there is no existing value with the same key(s),
 // returning true if stored. The first argument is ignored.
 func (d *DynamoMap) StoreIfAbsent(val interface{}) (stored bool, err error) {
-	if valItem, err := MarshalItem(val); err == nil {
-		return d.storeItemIfAbsent(valItem)
+	if valItem, err := d.MarshalItem(val); err == nil {
+		return d.storeItemIfAbsent(context.Background(), valItem)
 	}
 	return false, err
 }
 
-// LoadOrStore returns the value stored under same key(s) as the given value, if any,
-// else stores and returns the given value.
-// The loaded result is true if the value was loaded, false if stored.
-func (d *DynamoMap) loadOrStore(item Item) (Item, bool, error) {
+// StoreItemIfPresent stores the given item only if there is an existing item with the same key(s),
+// replacing it and returning true if stored. If there is no such item, nothing is stored and it returns false.
+// For ranged tables, both the hash and range key must match an existing item.
+func (d *DynamoMap) StoreItemIfPresent(val Itemable) (stored bool, err error) {
+	condition, err := d.presentCondition()
+	if err != nil {
+		return false, err
+	}
+	return d.storeIfBuilt(context.Background(), val.AsItem(), condition)
+}
+
+// StoreItemIf stores the given item if the given condition is true for any existing item with the same key(s),
+// returning true if stored, or false without error if the condition is false.
+// If there is no such item, the condition is evaluated as if against an item with no attributes.
+func (d *DynamoMap) StoreItemIf(val Itemable, condition expression.ConditionBuilder) (stored bool, err error) {
+	return d.storeIf(context.Background(), val.AsItem(), condition)
+}
+
+// AttributeIsType returns a condition that is true if the given attribute exists and has the given type,
+// using the attribute_type function, such as to only replace items not yet migrated to a new attribute type.
+func AttributeIsType(attr string, attrType expression.DynamoDBAttributeType) expression.ConditionBuilder {
+	return expression.Name(attr).AttributeType(attrType)
+}
+
+// loadOrStore returns the item stored under same key(s) as the given item, if any,
+// else stores and returns the given item.
+// The loaded result is true if the item was loaded, false if stored.
+// It returns the context error if the context is done before either succeeds.
+func (d *DynamoMap) loadOrStore(ctx context.Context, item Item) (Item, bool, error) {
 	for {
-		if result, loaded, err := d.load(item); loaded || err != nil {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		if result, loaded, err := d.load(ctx, item); loaded || err != nil {
 			return result, loaded, err
 		}
-		if stored, err := d.storeItemIfAbsent(item); stored || err != nil {
+		if stored, err := d.storeItemIfAbsent(ctx, item); stored || err != nil {
 			return item, !stored, err
 		}
 	}
@@ -361,7 +855,13 @@ func (d *DynamoMap) loadOrStore(item Item) (Item, bool, error) {
 // Otherwise, it stores and returns the given item.
 // The loaded result is true if the value was loaded, false if stored.
 func (d *DynamoMap) LoadOrStoreItem(val Itemable) (actual Item, loaded bool, err error) {
-	return d.loadOrStore(val.AsItem())
+	return d.loadOrStore(context.Background(), val.AsItem())
+}
+
+// LoadOrStoreItemWithContext is like LoadOrStoreItem, but stops retrying and returns the context error,
+// if the context is done before an item is either loaded or stored.
+func (d *DynamoMap) LoadOrStoreItemWithContext(ctx context.Context, val Itemable) (actual Item, loaded bool, err error) {
+	return d.loadOrStore(ctx, val.AsItem())
 }
 
 // LoadOrStore returns any value stored that has the same key as the given value, if any,
@@ -369,19 +869,18 @@ func (d *DynamoMap) LoadOrStoreItem(val Itemable) (actual Item, loaded bool, err
 // The loaded result is true if the value was loaded, false if stored.
 // The first argument is ignored.
 func (d *DynamoMap) LoadOrStore(val interface{}) (actual interface{}, loaded bool, err error) {
-	if valItem, err := MarshalItem(val); err == nil {
-		return d.loadOrStore(valItem)
+	if valItem, err := d.MarshalItem(val); err == nil {
+		return d.loadOrStore(context.Background(), valItem)
 	}
 	return nil, false, err
 }
 
 func (d *DynamoMap) storeItemIfVersion(item Item, version int64) (bool, error) {
-	hasVersion := expression.Name(d.VersionName).Equal(expression.Value(version))
-	err := d.store(item.AsItem(), &hasVersion)
-	if dynamodb.ErrCodeConditionalCheckFailedException == getErrCode(err) {
-		return false, nil
+	condition, err := d.versionCondition(version)
+	if err != nil {
+		return false, err
 	}
-	return err == nil, err
+	return d.storeIfBuilt(context.Background(), item, condition)
 }
 
 // StoreItemIfVersion stores the given item if there is an existing item with the same key(s) and the given version.
@@ -393,38 +892,397 @@ func (d *DynamoMap) StoreItemIfVersion(item Itemable, version int64) (ok bool, e
 // StoreIfVersion stores the given item if there is an existing item with the same key(s) and the given version.
 // Returns true if the item was stored.
 func (d *DynamoMap) StoreIfVersion(val interface{}, version int64) (ok bool) {
-	valItem, err := MarshalItem(val)
+	valItem, err := d.MarshalItem(val)
 	d.forbidErr(err)
 	ok, err2 := d.storeItemIfVersion(valItem, version)
 	d.forbidErr(err2)
 	return ok
 }
 
+// StoreItemIfNotNewer stores the given item unless there is an existing item with the same key(s)
+// and a newer value in the given timestamp attribute. Returns true if the item was stored.
+// The timestamp attribute must be present in the given item, and values are compared as DynamoDB numbers
+// or strings, so the attribute should hold epoch numbers or fixed format strings such as RFC3339 UTC.
+func (d *DynamoMap) StoreItemIfNotNewer(item Itemable, tsAttr string) (stored bool, err error) {
+	asItem := item.AsItem()
+	incoming, ok := asItem[tsAttr]
+	if !ok {
+		return false, fmt.Errorf("item missing timestamp attribute: %v", tsAttr)
+	}
+	return d.storeItemIfSequence(asItem, tsAttr, incoming, SequenceNotOlder)
+}
+
+// SequenceComparator builds a condition comparing the stored value of a sequence attribute with an incoming value,
+// such as SequenceNewer. DynamoDB compares numbers by value, and strings and binary values by their bytes.
+type SequenceComparator func(stored expression.NameBuilder, incoming expression.OperandBuilder) expression.ConditionBuilder
+
+// SequenceNewer is a SequenceComparator that is true if the incoming value is greater than the stored value.
+func SequenceNewer(stored expression.NameBuilder, incoming expression.OperandBuilder) expression.ConditionBuilder {
+	return stored.LessThan(incoming)
+}
+
+// SequenceNotOlder is a SequenceComparator that is true if the incoming value is not less than the stored value.
+func SequenceNotOlder(stored expression.NameBuilder, incoming expression.OperandBuilder) expression.ConditionBuilder {
+	return stored.LessThanEqual(incoming)
+}
+
+// StoreItemIfSequence stores the given item, with the incoming value set as its seqAttr attribute,
+// unless there is an existing item with the same key(s) and a seqAttr attribute for which the comparator is false.
+// Returns true if the item was stored. An existing item without the attribute is replaced.
+// The sequence may be a number, or a string that sorts in order, such as a ULID or a hybrid logical clock.
+// An existing attribute of a different type than the incoming value is never replaced.
+func (d *DynamoMap) StoreItemIfSequence(item Itemable, seqAttr string, incoming dynamodb.AttributeValue,
+	cmp SequenceComparator) (stored bool, err error) {
+	asItem := item.AsItem()
+	// the sequence attribute is set on a copy, so the given item is unchanged, even if not stored
+	sequenced := make(Item, len(asItem)+1)
+	for name, av := range asItem {
+		sequenced[name] = av
+	}
+	sequenced[seqAttr] = incoming
+	return d.storeItemIfSequence(sequenced, seqAttr, incoming, cmp)
+}
+
+// StoreItemIfSequenceNewer is StoreItemIfSequence with SequenceNewer, so the item is only stored if the incoming
+// sequence value is greater than the stored value, as for last writer wins conflict resolution.
+func (d *DynamoMap) StoreItemIfSequenceNewer(item Itemable, seqAttr string,
+	incoming dynamodb.AttributeValue) (stored bool, err error) {
+	return d.StoreItemIfSequence(item, seqAttr, incoming, SequenceNewer)
+}
+
+func (d *DynamoMap) storeItemIfSequence(item Item, seqAttr string, incoming dynamodb.AttributeValue,
+	cmp SequenceComparator) (bool, error) {
+	seq := expression.Name(seqAttr)
+	condition := expression.Or(seq.AttributeNotExists(), cmp(seq, exprValue(incoming)))
+	return d.storeIf(context.Background(), item, condition)
+}
+
 // RangeItems calls the given consumer for each stored item.
 // Iteration eventually stops if the given function returns false.
 func (d *DynamoMap) RangeItems(consumer func(Item) bool) error {
-	input := dynamodb.ScanInput{
-		TableName:      &d.TableName,
-		ConsistentRead: &d.ReadWithStrongConsistency,
-		Select:         dynamodb.SelectAllAttributes,
+	return d.rangeItems(context.Background(), d.scanInput(), stopOnFalse(consumer), nil)
+}
+
+// RangeItemsReport is like RangeItems, but also returns a report of the items and pages read by the scan,
+// the retries needed, and the time taken.
+func (d *DynamoMap) RangeItemsReport(consumer func(Item) bool) (ScanReport, error) {
+	var report ScanReport
+	start := time.Now()
+	err := d.rangeItems(context.Background(), d.scanInput(), stopOnFalse(consumer), &report)
+	report.Elapsed = time.Since(start)
+	return report, err
+}
+
+// RangeItemsFiltered calls the given consumer for each stored item that matches the given filter.
+// Items are still read, and capacity consumed, for the whole table.
+// Iteration eventually stops if the given function returns false.
+func (d *DynamoMap) RangeItemsFiltered(filter expression.ConditionBuilder, consumer func(Item) bool) error {
+	input, err := d.filteredScanInput(filter)
+	if err != nil {
+		return err
+	}
+	return d.rangeItems(context.Background(), input, stopOnFalse(consumer), nil)
+}
+
+// RangeAndDelete deletes every stored item that matches the given filter, returning how many were deleted.
+// Matching items are deleted in batches as the scan reads them, which does not disrupt the scan.
+// The filter is not checked again when deleting, so an item changed to no longer match after it is read
+// is still deleted. If an error is returned, some matching items may have been deleted.
+func (d *DynamoMap) RangeAndDelete(filter expression.ConditionBuilder) (deleted int, err error) {
+	input, err := d.filteredScanInput(filter)
+	if err != nil {
+		return 0, err
+	}
+	return d.deleteScanned(input)
+}
+
+// DeleteWhere deletes every stored item that matches the given filter, as with RangeAndDelete,
+// but scans again after each pass that deleted any items, until a pass finds no matching items
+// or maxPasses passes have been made. A scan may miss items stored while it is in progress,
+// so later passes delete matching items stored during earlier passes, such as on a live table.
+// Only key attributes are read, besides those the filter is evaluated against.
+// It returns the total number of items deleted by all passes, and clean is true if the last pass
+// found no matching items. If clean is false, matching items may remain. If maxPasses is less than 1, one is made.
+// In dry run mode, only one pass is made.
+func (d *DynamoMap) DeleteWhere(filter expression.ConditionBuilder, maxPasses int) (deleted int, clean bool,
+	err error) {
+	return d.deletePasses(&filter, maxPasses)
+}
+
+// Truncate deletes every stored item, as with DeleteWhere without a filter, returning the number deleted,
+// and true if the last pass found no items.
+func (d *DynamoMap) Truncate(maxPasses int) (deleted int, clean bool, err error) {
+	return d.deletePasses(nil, maxPasses)
+}
+
+// deletePasses deletes the items matching the filter, if not nil, in up to maxPasses scans.
+func (d *DynamoMap) deletePasses(filter *expression.ConditionBuilder, maxPasses int) (deleted int, clean bool,
+	err error) {
+	builder := expression.NewBuilder().WithProjection(d.keyProjection())
+	if filter != nil {
+		builder = builder.WithFilter(*filter)
 	}
+	expr, err := builder.Build()
+	if err != nil {
+		return 0, false, err
+	}
+	input := d.scanInput()
+	input.Select = dynamodb.SelectSpecificAttributes
+	input.ProjectionExpression = expr.Projection()
+	input.FilterExpression = expr.Filter()
+	input.ExpressionAttributeNames = expr.Names()
+	input.ExpressionAttributeValues = expr.Values()
+	for pass := 1; ; pass++ {
+		n, err := d.deleteScanned(input)
+		deleted += n
+		d.debug("delete pass:", pass, ", deleted:", n, ", error:", err)
+		if err != nil || n == 0 {
+			return deleted, err == nil, err
+		}
+		if pass >= maxPasses || d.DryRun {
+			return deleted, false, nil
+		}
+	}
+}
+
+// deleteScanned deletes every item read by a scan with the given input, returning how many were deleted.
+// Items are deleted in batches as the scan reads them, which does not disrupt the scan.
+func (d *DynamoMap) deleteScanned(input *dynamodb.ScanInput) (deleted int, err error) {
+	var mu sync.Mutex
+	var pending []dynamodb.WriteRequest
+	flush := func() error {
+		if _, err := d.batchWrite(context.Background(), pending); err != nil {
+			return err
+		}
+		deleted += len(pending)
+		pending = pending[:0]
+		return nil
+	}
+	err = d.rangeItems(context.Background(), input, func(item Item) error {
+		mu.Lock()
+		defer mu.Unlock()
+		pending = append(pending, dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{Key: d.ToKeyItem(item)}})
+		if len(pending) < maxBatchWriteItems {
+			return nil
+		}
+		return flush()
+	}, nil)
+	if err == nil {
+		err = flush()
+	}
+	return deleted, err
+}
+
+// filteredScanInput creates the input to scan items that match the given filter.
+func (d *DynamoMap) filteredScanInput(filter expression.ConditionBuilder) (*dynamodb.ScanInput, error) {
+	expr, err := expression.NewBuilder().WithFilter(filter).Build()
+	if err != nil {
+		return nil, err
+	}
+	input := d.scanInput()
+	input.FilterExpression = expr.Filter()
+	input.ExpressionAttributeNames = expr.Names()
+	input.ExpressionAttributeValues = expr.Values()
+	return input, nil
+}
+
+// RangeItemsSince calls the given consumer for each stored item where the given attribute is at or after since.
+// The attribute must hold a number of Unix epoch seconds, as with dynamodbattribute.UnixTime.
+// Items where the attribute is missing or is not a number are skipped.
+// Iteration eventually stops if the given function returns false.
+func (d *DynamoMap) RangeItemsSince(attr string, since time.Time, consumer func(Item) bool) error {
+	if attr == "" {
+		return errors.New("time attribute name is empty")
+	}
+	name := expression.Name(attr)
+	filter := name.AttributeType(expression.Number).And(name.GreaterThanEqual(expression.Value(since.Unix())))
+	return d.RangeItemsFiltered(filter, consumer)
+}
+
+// RangeItemsFrom calls the given consumer for each stored item, continuing a scan after the given key,
+// such as the LastEvaluatedKey of an earlier scan. The scan is always serial, ignoring ScanConcurrency.
+// Iteration stops if the given function returns false.
+func (d *DynamoMap) RangeItemsFrom(startKey Item, consumer func(Item) bool) error {
+	input := d.scanInput()
+	input.ExclusiveStartKey = startKey
 	worker := scanWorker{
-		input:    &input,
+		input:    input,
+		table:    d,
+		consumer: stopOnFalse(consumer),
+	}
+	return ignoreEarlyTermination(worker.work())
+}
+
+// RangeItemsBudget calls the given consumer for each stored item, as with RangeItemsFrom, until either every item
+// has been read, the consumer returns false, or maxDuration has elapsed, such as to process a large table
+// in time-sliced chunks. The budget is checked before each item after the first, so at least one item is read
+// if any are stored, but a slow consumer may exceed it.
+// If iteration stopped before every item was read, the returned token can be passed to RangeItemsBudgetFrom
+// to continue after the last item passed to the consumer. Otherwise the returned token is nil.
+func (d *DynamoMap) RangeItemsBudget(maxDuration time.Duration, consumer func(Item) bool) (resumeToken []byte,
+	err error) {
+	return d.RangeItemsBudgetFrom(nil, maxDuration, consumer)
+}
+
+// RangeItemsBudgetFrom is like RangeItemsBudget, but continues a scan after the item of the given resume token,
+// returned by an earlier call, or starts a new scan if the token is nil.
+func (d *DynamoMap) RangeItemsBudgetFrom(resumeToken []byte, maxDuration time.Duration,
+	consumer func(Item) bool) ([]byte, error) {
+	input := d.scanInput()
+	if len(resumeToken) > 0 {
+		if err := json.Unmarshal(resumeToken, &input.ExclusiveStartKey); err != nil {
+			return nil, fmt.Errorf("invalid scan resume token: %w", err)
+		}
+	}
+	deadline := time.Now().Add(maxDuration)
+	read := 0
+	worker := scanWorker{
+		input: input,
+		table: d,
+		consumer: func(item Item) error {
+			if read > 0 && !time.Now().Before(deadline) {
+				d.debug("scan budget spent, items read:", read)
+				return errBudgetSpent
+			}
+			read++
+			if !consumer(item) {
+				return errEarlyTermination
+			}
+			return nil
+		},
+	}
+	err := worker.work()
+	if err != errEarlyTermination && err != errBudgetSpent {
+		return nil, err
+	}
+	return json.Marshal(worker.lastKey)
+}
+
+// RangeIndexItems calls the given consumer for each item in the named secondary index.
+// Only items with the index key attributes set are in the index, so this can iterate a sparse index,
+// and only the attributes projected into the index are returned.
+// Global secondary indexes do not support strongly consistent reads, so ReadWithStrongConsistency is ignored.
+// Iteration eventually stops if the given function returns false.
+func (d *DynamoMap) RangeIndexItems(indexName string, consumer func(Item) bool) error {
+	if indexName == "" {
+		return errors.New("index name is empty")
+	}
+	input := d.scanInput()
+	input.IndexName = &indexName
+	input.ConsistentRead = aws.Bool(false)
+	input.Select = dynamodb.SelectAllProjectedAttributes
+	return d.rangeItems(context.Background(), input, stopOnFalse(consumer), nil)
+}
+
+func (d *DynamoMap) scanInput() *dynamodb.ScanInput {
+	return &dynamodb.ScanInput{
+		TableName:              &d.TableName,
+		ConsistentRead:         &d.ReadWithStrongConsistency,
+		Select:                 dynamodb.SelectAllAttributes,
+		ReturnConsumedCapacity: d.returnCapacity(),
+	}
+}
+
+// RangeItemsErr calls the given consumer for each stored item.
+// Iteration eventually stops if the consumer returns an error, and the first such error is returned.
+func (d *DynamoMap) RangeItemsErr(consumer func(Item) error) error {
+	return d.rangeItems(context.Background(), d.scanInput(), consumer, nil)
+}
+
+// RangeItemsChan scans the table in the background, sending each stored item on the returned item channel,
+// which is closed when the scan is done. Any error, including the context error if the context is done
+// before the scan is, is then sent on the returned error channel, which is closed after the item channel.
+// The scan stops once the context is done, canceling any scan request in progress and reading no further pages,
+// even if they have no items, so callers that stop receiving items should cancel the context to end the scan.
+func (d *DynamoMap) RangeItemsChan(ctx context.Context) (<-chan Item, <-chan error) {
+	items := make(chan Item)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		err := d.rangeItems(ctx, d.scanInput(), func(item Item) error {
+			select {
+			case items <- item:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}, nil)
+		close(items)
+		if err != nil {
+			errs <- err
+		}
+	}()
+	return items, errs
+}
+
+// stopOnFalse adapts a consumer that returns false to stop iteration to one that returns errEarlyTermination.
+func stopOnFalse(consumer func(Item) bool) func(Item) error {
+	return func(item Item) error {
+		if !consumer(item) {
+			return errEarlyTermination
+		}
+		return nil
+	}
+}
+
+// rangeItems scans with the given input, sending scan requests with the given context.
+// If the context is done before the scan is, the scan stops and the context error is returned.
+func (d *DynamoMap) rangeItems(ctx context.Context, input *dynamodb.ScanInput, consumer func(Item) error,
+	report *ScanReport) error {
+	worker := scanWorker{
+		input:    input,
 		table:    d,
 		consumer: consumer,
+		ctx:      ctx,
+		report:   report,
+	}
+
+	segments, first, count, err := d.scanSegments()
+	if err != nil {
+		return err
+	}
+	if segments == 1 {
+		return scanResult(ctx, worker.work())
+	}
+	workers := d.ScanConcurrency
+	if workers < 1 {
+		workers = 1
 	}
 
-	if d.ScanConcurrency <= 1 {
-		return worker.work()
+	group, groupCtx := errgroup.WithContext(ctx)
+	input.TotalSegments = aws.Int64(int64(segments))
+	worker.ctx = groupCtx
+	next := make(chan int, count)
+	for i := first; i < first+count; i++ {
+		next <- i
 	}
+	close(next)
+	for i := 0; i < workers; i++ {
+		group.Go(func() error {
+			for segment := range next {
+				if err := groupCtx.Err(); err != nil {
+					return errEarlyTermination
+				}
+				if err := worker.withID(segment, *input).work(); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return scanResult(ctx, group.Wait())
+}
 
-	group, ctx := errgroup.WithContext(context.Background())
-	input.TotalSegments = aws.Int64(int64(d.ScanConcurrency))
-	worker.ctx = ctx
-	for i := 0; i < d.ScanConcurrency; i++ {
-		group.Go(worker.withID(i, input).work)
+// scanResult returns the error of a scan, ignoring early termination,
+// or the context error if the scan failed or stopped early because the context is done.
+func scanResult(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil && err != nil {
+		return ctxErr
 	}
-	err := group.Wait()
+	return ignoreEarlyTermination(err)
+}
+
+func ignoreEarlyTermination(err error) error {
 	if err == errEarlyTermination {
 		return nil
 	}
@@ -434,7 +1292,7 @@ func (d *DynamoMap) RangeItems(consumer func(Item) bool) error {
 // Range iterates over the map and applies the given function to every value.
 // Iteration eventually stops if the given function returns false.
 // The consumed key will be nil unless KeyUnmarshaller is set.
-// The consumed value will be an Item unless ValueUnmarshaller is set.
+// The consumed value will be an Item unless ValueUnmarshaller or KeyValueUnmarshaller is set.
 func (d *DynamoMap) Range(consumer func(value interface{}) bool) error {
 	return d.RangeItems(func(item Item) bool {
 		return consumer(d.unmarshalValue(item))
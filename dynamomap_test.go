@@ -21,6 +21,8 @@ const (
 	debugEnv            = "DDBMAP_INTEG_DEBUG"
 	testPeopleTableName = "TestPeopleTable"
 	testCarsTableName   = "TestCarsTable"
+	testEventsTableName = "TestEventsTable"
+	rangeKeyName        = "Seq"
 	hashKeyName         = "Id"
 	retries             = 16
 	testTTL             = 2 * time.Hour
@@ -263,3 +265,42 @@ func TestDynamoMap(t *testing.T) {
 	}
 	checkMap(people, t)
 }
+
+func TestDynamoRangedStoreIfAbsent(t *testing.T) {
+	env, awsCfg := getTestEnv(t)
+	tCfg := TableConfig{
+		TableName:    testEventsTableName,
+		HashKeyName:  hashKeyName,
+		RangeKeyName: rangeKeyName,
+		Debug:        env.debug,
+		CreateTableOptions: CreateTableOptions{
+			CreateTableIfAbsent: true,
+			HashKeyType:         dynamodb.ScalarAttributeTypeS,
+			RangeKeyType:        dynamodb.ScalarAttributeTypeN,
+		},
+	}
+	events, err := tCfg.NewMap(awsCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e1 := Item{hashKeyName: ddbconv.EncodeString("a"), rangeKeyName: ddbconv.EncodeInt(1)}
+	e2 := Item{hashKeyName: ddbconv.EncodeString("a"), rangeKeyName: ddbconv.EncodeInt(2)}
+	defer events.DeleteItem(e1)
+	defer events.DeleteItem(e2)
+
+	if ok, err := events.StoreItemIfAbsent(e1); err != nil {
+		t.Fatal("unexpected error", err)
+	} else if !ok {
+		t.Fatal("expected to store first range key if absent, but did not")
+	}
+	if ok, err := events.StoreItemIfAbsent(e2); err != nil {
+		t.Fatal("unexpected error", err)
+	} else if !ok {
+		t.Fatal("expected to store second range key with same hash key if absent, but did not")
+	}
+	if ok, err := events.StoreItemIfAbsent(e1); err != nil {
+		t.Fatal("unexpected error", err)
+	} else if ok {
+		t.Fatal("expected to not store existing hash and range key if absent, but did")
+	}
+}
@@ -0,0 +1,76 @@
+package ddbmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// FieldEncryptor encrypts and decrypts attribute values for client side field level encryption,
+// such as with envelope encryption using AWS KMS. The attribute name is given so that implementations
+// can use a different key per attribute, or bind the ciphertext to the attribute as associated data.
+type FieldEncryptor interface {
+	// Encrypt encrypts the value of the named attribute before it is stored.
+	Encrypt(attr string, plaintext []byte) ([]byte, error)
+	// Decrypt reverses Encrypt on the value of the named attribute after it is loaded.
+	Decrypt(attr string, ciphertext []byte) ([]byte, error)
+}
+
+// encryptFields returns a copy of the item with each encrypted attribute replaced by its encrypted DynamoDB JSON,
+// as a Binary value. If no attribute is encrypted, the item itself is returned.
+func (d *DynamoMap) encryptFields(item Item) (Item, error) {
+	return d.applyEncryption(item, "encrypt", func(attr string, av dynamodb.AttributeValue) (dynamodb.AttributeValue,
+		error) {
+		plaintext, err := json.Marshal(jsonAttribute(av))
+		if err != nil {
+			return av, err
+		}
+		ciphertext, err := d.FieldEncryptor.Encrypt(attr, plaintext)
+		return dynamodb.AttributeValue{B: ciphertext}, err
+	})
+}
+
+// decryptFields reverses encryptFields. Encrypted attributes that are not Binary values are left as they are,
+// so that items stored before an attribute was encrypted can still be loaded.
+func (d *DynamoMap) decryptFields(item Item) (Item, error) {
+	return d.applyEncryption(item, "decrypt", func(attr string, av dynamodb.AttributeValue) (dynamodb.AttributeValue,
+		error) {
+		if av.B == nil {
+			return av, nil
+		}
+		plaintext, err := d.FieldEncryptor.Decrypt(attr, av.B)
+		if err != nil {
+			return av, err
+		}
+		return attributeFromJSON(plaintext)
+	})
+}
+
+func (d *DynamoMap) applyEncryption(item Item, op string,
+	apply func(attr string, av dynamodb.AttributeValue) (dynamodb.AttributeValue, error)) (Item, error) {
+	if d.FieldEncryptor == nil {
+		return item, nil
+	}
+	var result Item
+	for _, attr := range d.EncryptedAttributes {
+		av, ok := item[attr]
+		if !ok || attr == d.HashKeyName || attr == d.RangeKeyName {
+			continue
+		}
+		if result == nil {
+			result = make(Item, len(item))
+			for k, v := range item {
+				result[k] = v
+			}
+		}
+		applied, err := apply(attr, av)
+		if err != nil {
+			return nil, fmt.Errorf("cannot %s attribute %v: %w", op, attr, err)
+		}
+		result[attr] = applied
+	}
+	if result == nil {
+		return item, nil
+	}
+	return result, nil
+}
@@ -0,0 +1,134 @@
+package ddbmap
+
+import (
+	"bytes"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/shawnsmithdev/ddbmap/ddbconv"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// xorEncryptor is a FieldEncryptor for testing, binding each ciphertext to its attribute name.
+type xorEncryptor struct {
+	key byte
+}
+
+func (x xorEncryptor) Encrypt(attr string, plaintext []byte) ([]byte, error) {
+	ciphertext := append([]byte(attr+":"), plaintext...)
+	for i := range ciphertext {
+		ciphertext[i] ^= x.key
+	}
+	return ciphertext, nil
+}
+
+func (x xorEncryptor) Decrypt(attr string, ciphertext []byte) ([]byte, error) {
+	plaintext := make([]byte, len(ciphertext))
+	for i, c := range ciphertext {
+		plaintext[i] = c ^ x.key
+	}
+	if !bytes.HasPrefix(plaintext, []byte(attr+":")) {
+		return nil, errors.New("ciphertext is not of this attribute")
+	}
+	return plaintext[len(attr)+1:], nil
+}
+
+func TestFieldEncryptionRoundTrip(t *testing.T) {
+	encrypted := []string{"Id", "Sort", "Secret", "Count", "Profile", "Tags", "Flags", "Empty", "Missing"}
+	d := &DynamoMap{TableConfig: TableConfig{
+		TableName:           "Test",
+		HashKeyName:         "Id",
+		RangeKeyName:        "Sort",
+		FieldEncryptor:      xorEncryptor{key: 0x5a},
+		EncryptedAttributes: encrypted,
+	}}
+	item := Item{
+		"Id":     ddbconv.EncodeString("a"),
+		"Sort":   ddbconv.EncodeInt(1),
+		"Secret": ddbconv.EncodeString("s"),
+		"Count":  ddbconv.EncodeInt(42),
+		"Profile": dynamodb.AttributeValue{M: map[string]dynamodb.AttributeValue{
+			"Name": ddbconv.EncodeString("n"),
+			"Data": ddbconv.EncodeBinary([]byte{1, 2}),
+		}},
+		"Tags":  dynamodb.AttributeValue{SS: []string{"x", "y"}},
+		"Flags": dynamodb.AttributeValue{L: []dynamodb.AttributeValue{ddbconv.EncodeBool(true)}},
+		"Empty": dynamodb.AttributeValue{NULL: aws.Bool(true)},
+		"Plain": ddbconv.EncodeString("p"),
+	}
+	stored, err := d.encodeItem(item)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	// key attributes are never encrypted, even if named
+	for _, attr := range []string{"Id", "Sort", "Plain"} {
+		if !reflect.DeepEqual(stored[attr], item[attr]) {
+			t.Error("expected", attr, "not to be encrypted, got", stored[attr])
+		}
+	}
+	for _, attr := range []string{"Secret", "Count", "Profile", "Tags", "Flags", "Empty"} {
+		if stored[attr].B == nil {
+			t.Error("expected", attr, "to be encrypted, got", stored[attr])
+		}
+	}
+	if _, ok := stored["Missing"]; ok {
+		t.Error("expected a missing attribute to stay missing")
+	}
+	if item["Secret"].S == nil {
+		t.Error("expected the given item to be unchanged, got", item)
+	}
+	loaded, err := d.decodeItem(stored)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if !reflect.DeepEqual(loaded, item) {
+		t.Error("expected", item, "got", loaded)
+	}
+}
+
+func TestFieldEncryptionWithCodec(t *testing.T) {
+	d := &DynamoMap{TableConfig: TableConfig{
+		TableName:           "Test",
+		HashKeyName:         "Id",
+		AttributeCodecs:     map[string]Codec{"Body": GzipCodec{}},
+		FieldEncryptor:      xorEncryptor{key: 0x33},
+		EncryptedAttributes: []string{"Body"},
+	}}
+	item := Item{"Id": ddbconv.EncodeString("a"), "Body": ddbconv.EncodeBinary([]byte("body body body"))}
+	stored, err := d.encodeItem(item)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	loaded, err := d.decodeItem(stored)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if !reflect.DeepEqual(loaded, item) {
+		t.Error("expected", item, "got", loaded)
+	}
+}
+
+func TestFieldDecryption(t *testing.T) {
+	d := &DynamoMap{TableConfig: TableConfig{
+		TableName:           "Test",
+		HashKeyName:         "Id",
+		FieldEncryptor:      xorEncryptor{key: 0x5a},
+		EncryptedAttributes: []string{"Secret", "Other"},
+	}}
+	// values stored before an attribute was encrypted are loaded as they are
+	old := Item{"Id": ddbconv.EncodeString("a"), "Secret": ddbconv.EncodeString("s")}
+	if loaded, err := d.decodeItem(old); err != nil || !reflect.DeepEqual(loaded, old) {
+		t.Error("expected", old, "got", loaded, err)
+	}
+	// a ciphertext copied from another attribute does not decrypt
+	stored, err := d.encodeItem(Item{"Id": ddbconv.EncodeString("a"), "Secret": ddbconv.EncodeString("s")})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	stored["Other"] = stored["Secret"]
+	if _, err := d.decodeItem(stored); err == nil || !strings.Contains(err.Error(), "Other") {
+		t.Error("expected an error naming the attribute, got", err)
+	}
+}
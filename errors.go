@@ -0,0 +1,129 @@
+package ddbmap
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// ErrorKind classifies a DynamoError, so errors can be handled without comparing AWS error codes.
+type ErrorKind int
+
+const (
+	// ErrorOther is the kind of errors that fit no other kind, such as a network error.
+	ErrorOther ErrorKind = iota
+	// ErrorThrottled is the kind of errors from requests rejected for exceeding capacity or request limits,
+	// which may succeed if sent again later.
+	ErrorThrottled
+	// ErrorConditionFailed is the kind of errors from a condition that was false,
+	// including a transaction canceled by a failed condition check.
+	ErrorConditionFailed
+	// ErrorNotFound is the kind of errors from a missing table or index, and of ErrItemNotFound.
+	ErrorNotFound
+	// ErrorValidation is the kind of errors from invalid requests, such as a key of the wrong type,
+	// which fail again if sent again.
+	ErrorValidation
+	// ErrorInternal is the kind of errors from a server side failure, which may succeed if sent again later.
+	ErrorInternal
+)
+
+var errorKindNames = map[ErrorKind]string{
+	ErrorOther:           "Other",
+	ErrorThrottled:       "Throttled",
+	ErrorConditionFailed: "ConditionFailed",
+	ErrorNotFound:        "NotFound",
+	ErrorValidation:      "Validation",
+	ErrorInternal:        "Internal",
+}
+
+func (k ErrorKind) String() string {
+	if name, ok := errorKindNames[k]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// errorKindsByCode are the kinds of errors with known AWS error codes.
+var errorKindsByCode = map[string]ErrorKind{
+	dynamodb.ErrCodeProvisionedThroughputExceededException: ErrorThrottled,
+	dynamodb.ErrCodeRequestLimitExceeded:                   ErrorThrottled,
+	"ThrottlingException":                                  ErrorThrottled,
+	dynamodb.ErrCodeConditionalCheckFailedException:        ErrorConditionFailed,
+	dynamodb.ErrCodeResourceNotFoundException:              ErrorNotFound,
+	dynamodb.ErrCodeTableNotFoundException:                 ErrorNotFound,
+	"ValidationException":                                  ErrorValidation,
+	"SerializationException":                               ErrorValidation,
+	aws.InvalidParameterErrCode:                            ErrorValidation,
+	dynamodb.ErrCodeInternalServerError:                    ErrorInternal,
+	"ServiceUnavailable":                                   ErrorInternal,
+}
+
+// DynamoError classifies an error returned by ddbmap, with the AWS error code and message, if any.
+// Use AsError, or errors.As with any error from a DynamoDB request, to get a *DynamoError.
+type DynamoError struct {
+	// Kind classifies the error.
+	Kind ErrorKind
+	// Code is the AWS error code, such as ConditionalCheckFailedException, or empty if there is none.
+	Code string
+	// Message is the AWS error message, or empty if there is none.
+	Message string
+	// Err is the classified error.
+	Err error
+}
+
+func (e *DynamoError) Error() string {
+	return "ddbmap: " + e.Kind.String() + " error: " + e.Err.Error()
+}
+
+// Unwrap returns the classified error.
+func (e *DynamoError) Unwrap() error {
+	return e.Err
+}
+
+// AsError classifies the given error, returning false if it is nil.
+// Errors from DynamoDB requests are classified by their AWS error code, or as ErrorInternal if the response
+// had a 5xx status code. ErrItemNotFound is classified as ErrorNotFound, and any other error as ErrorOther.
+func AsError(err error) (*DynamoError, bool) {
+	if err == nil {
+		return nil, false
+	}
+	var result *DynamoError
+	if errors.As(err, &result) {
+		return result, true
+	}
+	result = &DynamoError{Kind: ErrorOther, Err: err}
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		result.Code, result.Message = aerr.Code(), aerr.Message()
+	}
+	var failure awserr.RequestFailure
+	switch kind, ok := errorKindsByCode[result.Code]; {
+	case ok:
+		result.Kind = kind
+	case isConditionCanceled(err):
+		result.Kind = ErrorConditionFailed
+	case errors.Is(err, ErrItemNotFound):
+		result.Kind = ErrorNotFound
+	case errors.As(err, &failure) && failure.StatusCode() >= 500:
+		result.Kind = ErrorInternal
+	}
+	return result, true
+}
+
+// As sets target to the classified error if it is a **DynamoError, so errors.As can classify a RequestError.
+// The classified error wraps this RequestError, so its operation, request ID and retries are not lost.
+func (e *RequestError) As(target interface{}) bool {
+	dynamoErr, ok := target.(**DynamoError)
+	if !ok {
+		return false
+	}
+	classified, ok := AsError(e.Err)
+	if !ok {
+		return false
+	}
+	wrapped := *classified
+	wrapped.Err = e
+	*dynamoErr = &wrapped
+	return true
+}
@@ -0,0 +1,36 @@
+package ddbmap
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"testing"
+)
+
+func TestAsErrorKeepsRequestError(t *testing.T) {
+	cause := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	err := &RequestError{Operation: "PutItem", RequestID: "abc", Retries: 2, Err: cause}
+	dynamoErr, ok := AsError(err)
+	if !ok || dynamoErr.Kind != ErrorConditionFailed || dynamoErr.Code != dynamodb.ErrCodeConditionalCheckFailedException {
+		t.Fatal("expected a condition failed error, got", dynamoErr, ok)
+	}
+	var requestErr *RequestError
+	if !errors.As(dynamoErr, &requestErr) || requestErr.Operation != "PutItem" || requestErr.RequestID != "abc" ||
+		requestErr.Retries != 2 {
+		t.Error("expected the request error to be kept, got", requestErr)
+	}
+	if !errors.Is(dynamoErr, cause) {
+		t.Error("expected the AWS error to be kept")
+	}
+}
+
+func TestAsErrorOfEmptyRequestError(t *testing.T) {
+	if dynamoErr, ok := AsError(&RequestError{Operation: "PutItem"}); !ok || dynamoErr == nil ||
+		dynamoErr.Kind != ErrorOther {
+		t.Error("expected an error of kind", ErrorOther, "got", dynamoErr, ok)
+	}
+	var dynamoErr *DynamoError
+	if (&RequestError{}).As(&dynamoErr) || dynamoErr != nil {
+		t.Error("expected a request error without a cause not to be classified, got", dynamoErr)
+	}
+}
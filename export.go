@@ -0,0 +1,126 @@
+package ddbmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"io"
+)
+
+// NewJSONLReader returns a reader of every stored item as JSON Lines, with one item per line in DynamoDB JSON,
+// the format used by the AWS CLI, such as {"id":{"N":"1"},"name":{"S":"Bob"}}. Binary values are base64 encoded.
+// The table is scanned in the background as the reader is read, and the scan waits while unread lines are pending,
+// so memory use is bounded however large the table is. Any scan error is returned by Read once earlier lines are read.
+// Closing the reader stops the scan. Items are read in scan order, so no order is guaranteed.
+func (d *DynamoMap) NewJSONLReader() io.ReadCloser {
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(d.RangeItemsErr(func(item Item) error {
+			line, err := json.Marshal(jsonAttributeMap(item))
+			if err != nil {
+				return err
+			}
+			// each line is written at once, so lines from parallel scan workers are not interleaved
+			_, err = w.Write(append(line, '\n'))
+			return err
+		}))
+	}()
+	return r
+}
+
+// jsonAttributeMap converts attributes into values that encode as DynamoDB JSON.
+func jsonAttributeMap(attrs map[string]dynamodb.AttributeValue) map[string]interface{} {
+	result := make(map[string]interface{}, len(attrs))
+	for name, av := range attrs {
+		result[name] = jsonAttribute(av)
+	}
+	return result
+}
+
+// jsonAttribute converts a single value into a value that encodes as DynamoDB JSON, such as {"S":"Bob"}.
+func jsonAttribute(av dynamodb.AttributeValue) map[string]interface{} {
+	switch {
+	case av.S != nil:
+		return map[string]interface{}{"S": *av.S}
+	case av.N != nil:
+		return map[string]interface{}{"N": *av.N}
+	case av.B != nil:
+		return map[string]interface{}{"B": av.B}
+	case av.BOOL != nil:
+		return map[string]interface{}{"BOOL": *av.BOOL}
+	case av.NULL != nil:
+		return map[string]interface{}{"NULL": *av.NULL}
+	case av.M != nil:
+		return map[string]interface{}{"M": jsonAttributeMap(av.M)}
+	case av.L != nil:
+		list := make([]interface{}, len(av.L))
+		for i, v := range av.L {
+			list[i] = jsonAttribute(v)
+		}
+		return map[string]interface{}{"L": list}
+	case av.SS != nil:
+		return map[string]interface{}{"SS": av.SS}
+	case av.NS != nil:
+		return map[string]interface{}{"NS": av.NS}
+	case av.BS != nil:
+		return map[string]interface{}{"BS": av.BS}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// attributeFromJSON reverses jsonAttribute, converting DynamoDB JSON into a single value.
+func attributeFromJSON(data []byte) (av dynamodb.AttributeValue, err error) {
+	var typed map[string]json.RawMessage
+	if err = json.Unmarshal(data, &typed); err != nil {
+		return av, err
+	}
+	for attrType, raw := range typed {
+		switch attrType {
+		case "S":
+			err = json.Unmarshal(raw, &av.S)
+		case "N":
+			err = json.Unmarshal(raw, &av.N)
+		case "B":
+			err = json.Unmarshal(raw, &av.B)
+		case "BOOL":
+			err = json.Unmarshal(raw, &av.BOOL)
+		case "NULL":
+			err = json.Unmarshal(raw, &av.NULL)
+		case "SS":
+			err = json.Unmarshal(raw, &av.SS)
+		case "NS":
+			err = json.Unmarshal(raw, &av.NS)
+		case "BS":
+			err = json.Unmarshal(raw, &av.BS)
+		case "M":
+			var m map[string]json.RawMessage
+			if err = json.Unmarshal(raw, &m); err != nil {
+				break
+			}
+			av.M = make(map[string]dynamodb.AttributeValue, len(m))
+			for name, v := range m {
+				if av.M[name], err = attributeFromJSON(v); err != nil {
+					break
+				}
+			}
+		case "L":
+			var l []json.RawMessage
+			if err = json.Unmarshal(raw, &l); err != nil {
+				break
+			}
+			av.L = make([]dynamodb.AttributeValue, len(l))
+			for i, v := range l {
+				if av.L[i], err = attributeFromJSON(v); err != nil {
+					break
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown attribute type: %v", attrType)
+		}
+		if err != nil {
+			return av, err
+		}
+	}
+	return av, nil
+}
@@ -0,0 +1,80 @@
+package ddbmap
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/expression"
+	"github.com/shawnsmithdev/ddbmap/ddbconv"
+	"sync"
+)
+
+// builtCondition is a condition expression ready to be set on a request.
+type builtCondition struct {
+	expression *string
+	names      map[string]string
+	values     map[string]dynamodb.AttributeValue
+}
+
+func buildCondition(condition expression.ConditionBuilder) (*builtCondition, error) {
+	expr, err := expression.NewBuilder().WithCondition(condition).Build()
+	if err != nil {
+		return nil, err
+	}
+	return &builtCondition{expression: expr.Condition(), names: expr.Names(), values: expr.Values()}, nil
+}
+
+// cachedConditions holds conditions that depend only on an attribute name, such as the absent condition
+// of StoreItemIfAbsent, so they are built once rather than on every call. Keys are the kind and attribute name.
+var cachedConditions sync.Map
+
+type conditionKey struct {
+	kind string
+	attr string
+}
+
+// cachedCondition returns the cached condition for the given kind and attribute, building and caching it if absent.
+// A condition with a value is built with a placeholder value, which must be replaced with withValue.
+func cachedCondition(kind, attr string, build func(expression.NameBuilder) expression.ConditionBuilder) (
+	*builtCondition, error) {
+	key := conditionKey{kind: kind, attr: attr}
+	if cached, ok := cachedConditions.Load(key); ok {
+		return cached.(*builtCondition), nil
+	}
+	built, err := buildCondition(build(expression.Name(attr)))
+	if err != nil {
+		return nil, err
+	}
+	cached, _ := cachedConditions.LoadOrStore(key, built)
+	return cached.(*builtCondition), nil
+}
+
+// withValue returns a copy of a cached condition with a single value, with that value replaced.
+// The cached condition is not changed, so it can be shared.
+func (c *builtCondition) withValue(av dynamodb.AttributeValue) *builtCondition {
+	result := *c
+	result.values = make(map[string]dynamodb.AttributeValue, len(c.values))
+	for placeholder := range c.values {
+		result.values[placeholder] = av
+	}
+	return &result
+}
+
+// absentCondition is true if there is no item with the same key(s).
+func (d *DynamoMap) absentCondition() (*builtCondition, error) {
+	return cachedCondition("absent", d.HashKeyName, expression.AttributeNotExists)
+}
+
+// presentCondition is true if there is an item with the same key(s).
+func (d *DynamoMap) presentCondition() (*builtCondition, error) {
+	return cachedCondition("present", d.HashKeyName, expression.AttributeExists)
+}
+
+// versionCondition is true if there is an item with the same key(s) and the given version.
+func (d *DynamoMap) versionCondition(version int64) (*builtCondition, error) {
+	cached, err := cachedCondition("version", d.VersionName, func(name expression.NameBuilder) expression.ConditionBuilder {
+		return name.Equal(expression.Value(int64(0)))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cached.withValue(ddbconv.EncodeInt64(version)), nil
+}
@@ -5,4 +5,4 @@ require (
 	golang.org/x/sync v0.0.0-20190423024810-112230192c58
 )
 
-go 1.12
+go 1.13
@@ -0,0 +1,158 @@
+package ddbmap
+
+import "time"
+
+// Hooks are called around each method call of a map wrapped by WrapMap or WrapItemMap,
+// such as to log or meter every operation.
+type Hooks struct {
+	// Before, if not nil, is called before each method, with the method name, such as "Store".
+	Before func(method string)
+	// After, if not nil, is called after each method, with the method name, the time taken,
+	// and any error returned by the method.
+	After func(method string, elapsed time.Duration, err error)
+}
+
+// call runs the given method between the hooks.
+func (h Hooks) call(method string, f func() error) error {
+	if h.Before != nil {
+		h.Before(method)
+	}
+	start := time.Now()
+	err := f()
+	if h.After != nil {
+		h.After(method, time.Since(start), err)
+	}
+	return err
+}
+
+// WrapMap returns a Map that calls the given hooks around each method call on the given map.
+func WrapMap(m Map, hooks Hooks) Map {
+	return &hookedMap{m: m, hooks: hooks}
+}
+
+type hookedMap struct {
+	m     Map
+	hooks Hooks
+}
+
+var _ Map = &hookedMap{}
+
+func (h *hookedMap) Delete(toDelete interface{}) error {
+	return h.hooks.call("Delete", func() error {
+		return h.m.Delete(toDelete)
+	})
+}
+
+func (h *hookedMap) Load(toLoad interface{}) (result interface{}, ok bool, err error) {
+	err = h.hooks.call("Load", func() error {
+		result, ok, err = h.m.Load(toLoad)
+		return err
+	})
+	return result, ok, err
+}
+
+func (h *hookedMap) LoadOrStore(value interface{}) (actual interface{}, loaded bool, err error) {
+	err = h.hooks.call("LoadOrStore", func() error {
+		actual, loaded, err = h.m.LoadOrStore(value)
+		return err
+	})
+	return actual, loaded, err
+}
+
+func (h *hookedMap) Range(consumer func(value interface{}) (resume bool)) error {
+	return h.hooks.call("Range", func() error {
+		return h.m.Range(consumer)
+	})
+}
+
+func (h *hookedMap) Store(toStore interface{}) error {
+	return h.hooks.call("Store", func() error {
+		return h.m.Store(toStore)
+	})
+}
+
+func (h *hookedMap) StoreIfAbsent(toStore interface{}) (stored bool, err error) {
+	err = h.hooks.call("StoreIfAbsent", func() error {
+		stored, err = h.m.StoreIfAbsent(toStore)
+		return err
+	})
+	return stored, err
+}
+
+// WrapItemMap returns an ItemMap that calls the given hooks around each method call on the given map.
+func WrapItemMap(m ItemMap, hooks Hooks) ItemMap {
+	return &hookedItemMap{m: m, hooks: hooks}
+}
+
+type hookedItemMap struct {
+	m     ItemMap
+	hooks Hooks
+}
+
+var _ ItemMap = &hookedItemMap{}
+
+func (h *hookedItemMap) DeleteItem(keys Itemable) error {
+	return h.hooks.call("DeleteItem", func() error {
+		return h.m.DeleteItem(keys)
+	})
+}
+
+func (h *hookedItemMap) LoadItem(keys Itemable) (item Item, ok bool, err error) {
+	err = h.hooks.call("LoadItem", func() error {
+		item, ok, err = h.m.LoadItem(keys)
+		return err
+	})
+	return item, ok, err
+}
+
+func (h *hookedItemMap) StoreItem(item Itemable) error {
+	return h.hooks.call("StoreItem", func() error {
+		return h.m.StoreItem(item)
+	})
+}
+
+func (h *hookedItemMap) LoadOrStoreItem(item Itemable) (actual Item, loaded bool, err error) {
+	err = h.hooks.call("LoadOrStoreItem", func() error {
+		actual, loaded, err = h.m.LoadOrStoreItem(item)
+		return err
+	})
+	return actual, loaded, err
+}
+
+func (h *hookedItemMap) StoreIfAbsent(val interface{}) (stored bool, err error) {
+	err = h.hooks.call("StoreIfAbsent", func() error {
+		stored, err = h.m.StoreIfAbsent(val)
+		return err
+	})
+	return stored, err
+}
+
+func (h *hookedItemMap) StoreItemIfAbsent(item Itemable) (stored bool, err error) {
+	err = h.hooks.call("StoreItemIfAbsent", func() error {
+		stored, err = h.m.StoreItemIfAbsent(item)
+		return err
+	})
+	return stored, err
+}
+
+func (h *hookedItemMap) RangeItems(consumer func(Item) (resume bool)) error {
+	return h.hooks.call("RangeItems", func() error {
+		return h.m.RangeItems(consumer)
+	})
+}
+
+func (h *hookedItemMap) StoreIfVersion(val interface{}, version int64) (ok bool) {
+	h.hooks.call("StoreIfVersion", func() error {
+		ok = h.m.StoreIfVersion(val, version)
+		return nil
+	})
+	return ok
+}
+
+func (h *hookedItemMap) StoreItemIfVersion(item Itemable, version int64) (ok bool, err error) {
+	err = h.hooks.call("StoreItemIfVersion", func() error {
+		ok, err = h.m.StoreItemIfVersion(item, version)
+		return err
+	})
+	return ok, err
+}
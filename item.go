@@ -1,12 +1,18 @@
 package ddbmap
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/expression"
 	"github.com/shawnsmithdev/ddbmap/ddbconv"
+	"io"
+	"math/big"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -41,38 +47,273 @@ func (item Item) IsNull(attr string) bool {
 	return false
 }
 
+// GetAsStringSet returns the values of the given StringSet (SS) attribute,
+// which will be empty if the attribute is missing or is not a StringSet.
+func (item Item) GetAsStringSet(attr string) []string {
+	return ddbconv.DecodeStringSet(item[attr])
+}
+
+// GetAsIntSet returns the values of the given NumberSet (NS) attribute, which will be empty if the attribute
+// is missing, is not a NumberSet, or has any value that is not an integral number that will fit in an int.
+func (item Item) GetAsIntSet(attr string) []int {
+	return ddbconv.DecodeIntSet(item[attr])
+}
+
+// GetAsBinarySet returns the values of the given BinarySet (BS) attribute,
+// which will be empty if the attribute is missing or is not a BinarySet.
+func (item Item) GetAsBinarySet(attr string) [][]byte {
+	return ddbconv.DecodeBinarySet(item[attr])
+}
+
 // Project returns a new item based on this one, but with only the specified attributes.
+// An attribute may be a dot separated path into nested maps, such as profile.name,
+// in which case only that part of the enclosing maps is copied, as with a DynamoDB projection expression.
+// A top level attribute with a name that contains a dot is copied as is.
+// List indexes, such as tags[0], are not supported, so such a path copies nothing, unless it is an attribute name.
 func (item Item) Project(attrs ...string) Item {
 	result := make(Item, len(attrs))
 	for _, attr := range attrs {
 		if val, ok := item[attr]; ok {
 			result[attr] = val
+		} else if strings.Contains(attr, ".") {
+			projectPath(item, result, strings.Split(attr, "."))
 		}
 	}
 	return result
 }
 
-// String returns a string representation of the content of the item
+// projectPath copies the value at the given path in src, if any, to the same path in dest,
+// returning true if copied. Maps are created in dest as needed, and are never shared with src,
+// unless a whole map from src was already copied, as it already includes the path.
+func projectPath(src, dest map[string]dynamodb.AttributeValue, path []string) bool {
+	val, ok := src[path[0]]
+	if !ok {
+		return false
+	}
+	if len(path) == 1 {
+		dest[path[0]] = val
+		return true
+	}
+	if val.M == nil {
+		return false
+	}
+	sub := make(map[string]dynamodb.AttributeValue)
+	if existing, ok := dest[path[0]]; ok && existing.M != nil {
+		if reflect.ValueOf(existing.M).Pointer() == reflect.ValueOf(val.M).Pointer() {
+			return true
+		}
+		sub = existing.M
+	}
+	if !projectPath(val.M, sub, path[1:]) {
+		return false
+	}
+	dest[path[0]] = dynamodb.AttributeValue{M: sub}
+	return true
+}
+
+// Size returns the approximate size in bytes of this item, as counted by DynamoDB against the item size limit.
+func (item Item) Size() int {
+	size := 0
+	for k, v := range item {
+		size += len(k) + attributeSize(v)
+	}
+	return size
+}
+
+// attributeSize approximates the size of a single value using the DynamoDB item size rules.
+func attributeSize(av dynamodb.AttributeValue) int {
+	switch {
+	case av.S != nil:
+		return len(*av.S)
+	case av.N != nil:
+		return numberSize(*av.N)
+	case av.B != nil:
+		return len(av.B)
+	case av.BOOL != nil, av.NULL != nil:
+		return 1
+	case av.SS != nil:
+		size := 0
+		for _, s := range av.SS {
+			size += len(s)
+		}
+		return size
+	case av.NS != nil:
+		size := 0
+		for _, n := range av.NS {
+			size += numberSize(n)
+		}
+		return size
+	case av.BS != nil:
+		size := 0
+		for _, b := range av.BS {
+			size += len(b)
+		}
+		return size
+	case av.L != nil:
+		size := 3
+		for _, v := range av.L {
+			size += 1 + attributeSize(v)
+		}
+		return size
+	case av.M != nil:
+		size := 3
+		for k, v := range av.M {
+			size += 1 + len(k) + attributeSize(v)
+		}
+		return size
+	}
+	return 0
+}
+
+// numberSize approximates the size of a number, which DynamoDB stores as one byte per two significant digits plus one.
+func numberSize(n string) int {
+	digits := 0
+	for _, c := range n {
+		if c == 'e' || c == 'E' {
+			break
+		}
+		if c >= '0' && c <= '9' {
+			digits++
+		}
+	}
+	return (digits+1)/2 + 1
+}
+
+// String returns a string representation of the content of the item, with attributes in name order.
+// It is meant for display, so binary values are abbreviated to their length; use it to log items, not to compare them.
 func (item Item) String() string {
+	var b strings.Builder
+	writeItem(&b, item)
+	return b.String()
+}
+
+// keyString returns a string that identifies the content of the item, such as to find duplicate keys.
+// Unlike String, which is for display and abbreviates binary values, items with different content
+// always have different key strings. Number attributes are compared by value, as DynamoDB compares keys,
+// so 1, 1.0 and 1e0 are the same.
+func (item Item) keyString() string {
+	canonical := make(map[string]dynamodb.AttributeValue, len(item))
+	for name, av := range item {
+		if av.N != nil {
+			av = dynamodb.AttributeValue{N: aws.String(canonicalNumber(*av.N))}
+		}
+		canonical[name] = av
+	}
+	// encoding/json writes map keys in sorted order, and binary values in full as base64
+	b, err := json.Marshal(canonical)
+	if err != nil {
+		// not possible for attribute values, which hold only strings, bools, byte slices, maps, and slices
+		panic(err)
+	}
+	return string(b)
+}
+
+// canonicalNumber returns a number in a form in which equal numbers are equal strings,
+// or the number as is if it is not valid, for DynamoDB to reject.
+func canonicalNumber(n string) string {
+	if r, ok := new(big.Rat).SetString(n); ok {
+		return r.RatString()
+	}
+	return n
+}
+
+// Format implements fmt.Formatter, writing the same representation as String directly to the output.
+// The %#v verb prints the underlying map instead.
+func (item Item) Format(f fmt.State, verb rune) {
+	if verb == 'v' && f.Flag('#') {
+		fmt.Fprintf(f, "%#v", map[string]dynamodb.AttributeValue(item))
+		return
+	}
+	writeItem(f, item)
+}
+
+func writeItem(w io.Writer, item Item) {
+	io.WriteString(w, "item")
+	writeAttributeMap(w, item)
+}
+
+func writeAttributeMap(w io.Writer, attrs map[string]dynamodb.AttributeValue) {
 	// print in order
-	var attrs []string
-	for k := range item {
-		attrs = append(attrs, k)
+	names := make([]string, 0, len(attrs))
+	for k := range attrs {
+		names = append(names, k)
 	}
-	sort.Strings(attrs)
+	sort.Strings(names)
 
-	result := "item{"
-	for _, k := range attrs {
-		v := item[k]
-		// attributevalue String() has unwanted newlines and whitespace
-		vstr := strings.Replace(v.String(), "\n  ", "", -1)
-		vstr = strings.Replace(vstr, "\n", "", -1)
-		result = result + fmt.Sprintf("%v:%v, ", k, vstr)
+	io.WriteString(w, "{")
+	for i, k := range names {
+		if i > 0 {
+			io.WriteString(w, ", ")
+		}
+		io.WriteString(w, k)
+		io.WriteString(w, ":")
+		writeAttribute(w, attrs[k])
 	}
-	if len(attrs) > 0 {
-		result = result[:len(result)-2]
+	io.WriteString(w, "}")
+}
+
+// writeAttribute writes a single value by type, such as {S: "Bob"}, {N: 20}, or {L: [{BOOL: true}]}.
+func writeAttribute(w io.Writer, av dynamodb.AttributeValue) {
+	switch {
+	case av.S != nil:
+		io.WriteString(w, "{S: ")
+		io.WriteString(w, strconv.Quote(*av.S))
+	case av.N != nil:
+		io.WriteString(w, "{N: ")
+		io.WriteString(w, *av.N)
+	case av.B != nil:
+		fmt.Fprintf(w, "{B: <binary> len %d", len(av.B))
+	case av.BOOL != nil:
+		io.WriteString(w, "{BOOL: ")
+		io.WriteString(w, strconv.FormatBool(*av.BOOL))
+	case av.NULL != nil:
+		io.WriteString(w, "{NULL: ")
+		io.WriteString(w, strconv.FormatBool(*av.NULL))
+	case av.M != nil:
+		io.WriteString(w, "{M: ")
+		writeAttributeMap(w, av.M)
+	case av.L != nil:
+		io.WriteString(w, "{L: [")
+		for i, v := range av.L {
+			if i > 0 {
+				io.WriteString(w, ", ")
+			}
+			writeAttribute(w, v)
+		}
+		io.WriteString(w, "]")
+	case av.SS != nil:
+		io.WriteString(w, "{SS: [")
+		for i, v := range av.SS {
+			if i > 0 {
+				io.WriteString(w, ", ")
+			}
+			io.WriteString(w, strconv.Quote(v))
+		}
+		io.WriteString(w, "]")
+	case av.NS != nil:
+		io.WriteString(w, "{NS: [")
+		io.WriteString(w, strings.Join(av.NS, ", "))
+		io.WriteString(w, "]")
+	case av.BS != nil:
+		fmt.Fprintf(w, "{BS: <binary> len %d", len(av.BS))
+	default:
+		io.WriteString(w, "{")
 	}
-	return result + "}"
+	io.WriteString(w, "}")
+}
+
+// attributeValue allows an AttributeValue to be used as-is in an expression, without being marshalled again.
+type attributeValue dynamodb.AttributeValue
+
+// MarshalDynamoDBAttributeValue implements dynamodbattribute.Marshaler.
+func (av attributeValue) MarshalDynamoDBAttributeValue(out *dynamodb.AttributeValue) error {
+	*out = dynamodb.AttributeValue(av)
+	return nil
+}
+
+// exprValue returns an expression value for the given AttributeValue.
+func exprValue(av dynamodb.AttributeValue) expression.ValueBuilder {
+	return expression.Value(attributeValue(av))
 }
 
 // Itemable is implemented by types that can directly build representations of their data in the DynamoDB type system.
@@ -123,28 +364,163 @@ type ItemMap interface {
 // ItemUnmarshaller is a function that can convert an Item into some other type
 type ItemUnmarshaller func(Item) (interface{}, error)
 
+// DiscriminatedUnmarshaller creates a new ItemUnmarshaller that passes each item to one of the given unmarshallers,
+// chosen by the string value of the discriminator attribute attr, such as for tables that store several types.
+// The returned unmarshaller returns an error if the attribute is missing or not a string,
+// or if there is no unmarshaller for its value.
+func DiscriminatedUnmarshaller(attr string, unmarshallers map[string]ItemUnmarshaller) ItemUnmarshaller {
+	return func(item Item) (interface{}, error) {
+		kind, ok := ddbconv.TryDecodeString(item[attr])
+		if !ok {
+			return nil, fmt.Errorf("discriminator attribute %v missing or not a string", attr)
+		}
+		unmarshaller, ok := unmarshallers[kind]
+		if !ok {
+			return nil, fmt.Errorf("no unmarshaller for %v: %v", attr, kind)
+		}
+		return unmarshaller(item)
+	}
+}
+
+// KeyValueUnmarshaller is a function that can convert an Item into some other type, given also its key item.
+type KeyValueUnmarshaller func(key, value Item) (interface{}, error)
+
 // UnmarshallerForType creates a new ItemUnmashaller function from a template.
 // The template may be any value of the struct type you want items to be unmarshalled into, such as the zero value.
 func UnmarshallerForType(template interface{}) ItemUnmarshaller {
+	return unmarshallerForType(template, func(item Item, dest interface{}) error {
+		return dynamodbattribute.UnmarshalMap(item, dest)
+	})
+}
+
+func unmarshallerForType(template interface{}, unmarshal func(Item, interface{}) error) ItemUnmarshaller {
 	t := reflect.TypeOf(template)
 	return func(item Item) (interface{}, error) {
 		val := reflect.New(t).Interface()
-		if err := dynamodbattribute.UnmarshalMap(item, val); err != nil {
+		if err := unmarshal(item, val); err != nil {
 			return nil, err
 		}
 		return reflect.ValueOf(val).Elem().Interface(), nil
 	}
 }
 
+// ItemMarshaller is a function that can convert some other type into an Item
+type ItemMarshaller func(interface{}) (Item, error)
+
 // MarshalItem will marshal a value into an Item using dynamodbattribute.MarshalMap,
-// unless this can be avoided because the value is already an Item or is Itemable.
+// unless this can be avoided because the value is already an Item, an attribute value map, or is Itemable.
 func MarshalItem(val interface{}) (Item, error) {
 	switch valAsType := val.(type) {
 	case Item:
 		return valAsType, nil
+	case map[string]dynamodb.AttributeValue:
+		return valAsType, nil
 	case Itemable:
 		return valAsType.AsItem(), nil
 	default:
 		return dynamodbattribute.MarshalMap(val)
 	}
 }
+
+// MarshalItems marshals each of the given values into an Item, as with MarshalItem.
+// If any value cannot be marshalled, it stops and returns an error that includes the index of that value.
+func MarshalItems(vals []interface{}) ([]Item, error) {
+	items := make([]Item, len(vals))
+	for i, val := range vals {
+		item, err := MarshalItem(val)
+		if err != nil {
+			return nil, fmt.Errorf("cannot marshal value at index %d: %w", i, err)
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+// DiffItems compares two versions of an item, returning the attributes that are new or changed in newItem,
+// and the names, in order, of the attributes in oldItem that are missing from newItem.
+// These can be passed to Upsert to change oldItem into newItem, writing only what is different.
+// Numbers are compared by value, so 1 and 1.0 are equal, and sets are compared regardless of order.
+func DiffItems(oldItem, newItem Item) (set map[string]dynamodb.AttributeValue, remove []string) {
+	set = make(map[string]dynamodb.AttributeValue)
+	for name, newVal := range newItem {
+		if oldVal, ok := oldItem[name]; !ok || !attributesEqual(oldVal, newVal) {
+			set[name] = newVal
+		}
+	}
+	for name := range oldItem {
+		if _, ok := newItem[name]; !ok {
+			remove = append(remove, name)
+		}
+	}
+	sort.Strings(remove)
+	return set, remove
+}
+
+// attributesEqual returns true if two values are the same type and have the same value.
+func attributesEqual(a, b dynamodb.AttributeValue) bool {
+	switch {
+	case a.N != nil && b.N != nil:
+		return ddbconv.CompareNumbers(dynamodbattribute.Number(*a.N), dynamodbattribute.Number(*b.N)) == 0
+	case a.M != nil && b.M != nil:
+		if len(a.M) != len(b.M) {
+			return false
+		}
+		for name, aVal := range a.M {
+			if bVal, ok := b.M[name]; !ok || !attributesEqual(aVal, bVal) {
+				return false
+			}
+		}
+		return true
+	case a.L != nil && b.L != nil:
+		if len(a.L) != len(b.L) {
+			return false
+		}
+		for i := range a.L {
+			if !attributesEqual(a.L[i], b.L[i]) {
+				return false
+			}
+		}
+		return true
+	case a.SS != nil && b.SS != nil:
+		return sameSet(a.SS, b.SS)
+	case a.NS != nil && b.NS != nil:
+		// canonical form, so that equal numbers are equal strings
+		return sameSet(canonicalNumbers(a.NS), canonicalNumbers(b.NS))
+	case a.BS != nil && b.BS != nil:
+		return sameSet(binaryStrings(a.BS), binaryStrings(b.BS))
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// sameSet returns true if a and b have the same elements, in any order.
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[string]int, len(a))
+	for _, s := range a {
+		counts[s]++
+	}
+	for _, s := range b {
+		if counts[s]--; counts[s] < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func canonicalNumbers(ns []string) []string {
+	result := make([]string, len(ns))
+	for i, n := range ns {
+		result[i] = string(ddbconv.AddNumbers(dynamodbattribute.Number(n), "0"))
+	}
+	return result
+}
+
+func binaryStrings(bs [][]byte) []string {
+	result := make([]string, len(bs))
+	for i, b := range bs {
+		result[i] = string(b)
+	}
+	return result
+}
@@ -0,0 +1,300 @@
+package ddbmap
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/shawnsmithdev/ddbmap/ddbconv"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+type itemableKey struct {
+	id string
+}
+
+func (k itemableKey) AsItem() Item {
+	return Item{"Id": ddbconv.EncodeString(k.id)}
+}
+
+func TestMarshalItemShortCircuits(t *testing.T) {
+	item := Item{"Id": ddbconv.EncodeString("a")}
+	attrs := map[string]dynamodb.AttributeValue{"Id": ddbconv.EncodeString("b")}
+	tc := TableConfig{
+		HashKeyName:         "Id",
+		EmptyStringBehavior: EmptyStringOmit,
+		ZeroValueBehavior:   ZeroValuesOmitAll,
+		NameMapper:          SnakeCase,
+		Marshaller: func(interface{}) (Item, error) {
+			return nil, errors.New("marshaller should not be called")
+		},
+	}
+	tests := []struct {
+		name string
+		val  interface{}
+		want Item
+		same bool
+	}{
+		{name: "Item", val: item, want: item, same: true},
+		{name: "attribute value map", val: attrs, want: attrs, same: true},
+		{name: "Itemable", val: itemableKey{id: "c"}, want: Item{"Id": ddbconv.EncodeString("c")}},
+	}
+	marshallers := map[string]func(interface{}) (Item, error){
+		"MarshalItem":             MarshalItem,
+		"TableConfig.MarshalItem": tc.MarshalItem,
+	}
+	for marshallerName, marshal := range marshallers {
+		for _, test := range tests {
+			got, err := marshal(test.val)
+			if err != nil {
+				t.Fatal(marshallerName, test.name, "unexpected error", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatal(marshallerName, test.name, "expected", test.want, "got", got)
+			}
+			if test.same && reflect.ValueOf(got).Pointer() != reflect.ValueOf(test.val).Pointer() {
+				t.Fatal(marshallerName, test.name, "expected the same map to be returned, not a copy")
+			}
+		}
+	}
+}
+
+func TestItemStringAndKeyStringOfBinary(t *testing.T) {
+	b1 := Item{"Id": ddbconv.EncodeBinary([]byte{1, 2})}
+	b2 := Item{"Id": ddbconv.EncodeBinary([]byte{3, 4})}
+	bs1 := Item{"Id": ddbconv.EncodeBinarySet([][]byte{{1}, {2}})}
+	bs2 := Item{"Id": ddbconv.EncodeBinarySet([][]byte{{3}, {4}})}
+
+	if got, want := b1.String(), "item{Id:{B: <binary> len 2}}"; got != want {
+		t.Error("expected", want, "got", got)
+	}
+	if got, want := bs1.String(), "item{Id:{BS: <binary> len 2}}"; got != want {
+		t.Error("expected", want, "got", got)
+	}
+	for _, pair := range [][2]Item{{b1, b2}, {bs1, bs2}, {b1, bs1}} {
+		if pair[0].keyString() == pair[1].keyString() {
+			t.Error("expected different key strings for", pair[0], "and", pair[1])
+		}
+	}
+	same := Item{"Id": ddbconv.EncodeBinary([]byte{1, 2})}
+	if b1.keyString() != same.keyString() {
+		t.Error("expected equal key strings for equal items")
+	}
+}
+
+func TestBatchKeysBinary(t *testing.T) {
+	d := &DynamoMap{TableConfig: TableConfig{
+		HashKeyName:        "Id",
+		CreateTableOptions: CreateTableOptions{HashKeyType: dynamodb.ScalarAttributeTypeB},
+	}}
+	keys := []Itemable{
+		Item{"Id": ddbconv.EncodeBinary([]byte{1, 2}), "Other": ddbconv.EncodeString("x")},
+		Item{"Id": ddbconv.EncodeBinary([]byte{3, 4})},
+		Item{"Id": ddbconv.EncodeBinary([]byte{1, 2})},
+	}
+	got, err := d.batchKeys(keys)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	want := []Item{
+		{"Id": ddbconv.EncodeBinary([]byte{1, 2})},
+		{"Id": ddbconv.EncodeBinary([]byte{3, 4})},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("expected", want, "got", got)
+	}
+}
+
+func TestBatchKeysNumbers(t *testing.T) {
+	d := &DynamoMap{TableConfig: TableConfig{
+		HashKeyName:        "Id",
+		CreateTableOptions: CreateTableOptions{HashKeyType: dynamodb.ScalarAttributeTypeN},
+	}}
+	keys := []Itemable{
+		Item{"Id": dynamodb.AttributeValue{N: aws.String("1")}},
+		Item{"Id": dynamodb.AttributeValue{N: aws.String("1.0")}},
+		Item{"Id": dynamodb.AttributeValue{N: aws.String("1e0")}},
+		Item{"Id": dynamodb.AttributeValue{N: aws.String("0.1E1")}},
+		Item{"Id": dynamodb.AttributeValue{N: aws.String("1.5")}},
+		Item{"Id": dynamodb.AttributeValue{N: aws.String("15e-1")}},
+		Item{"Id": dynamodb.AttributeValue{N: aws.String("-1")}},
+	}
+	got, err := d.batchKeys(keys)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	want := []Item{
+		{"Id": dynamodb.AttributeValue{N: aws.String("1")}},
+		{"Id": dynamodb.AttributeValue{N: aws.String("1.5")}},
+		{"Id": dynamodb.AttributeValue{N: aws.String("-1")}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("expected", want, "got", got)
+	}
+	if (Item{"Id": ddbconv.EncodeString("1")}).keyString() == (Item{"Id": ddbconv.EncodeInt(1)}).keyString() {
+		t.Error("expected a String (S) and a Number (N) key to differ")
+	}
+}
+
+func TestIsDecimal(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"0", true},
+		{"-12", true},
+		{"+12", true},
+		{"3.5", true},
+		{".5", true},
+		{"5.", true},
+		{"1e10", true},
+		{"1E-10", true},
+		{"-1.5e+3", true},
+		{" 42 ", true},
+		{"", false},
+		{"-", false},
+		{".", false},
+		{"e5", false},
+		{"1e", false},
+		{"1e+", false},
+		{"1.2.3", false},
+		{"1e5.5", false},
+		{"1e2e3", false},
+		{"--1", false},
+		{"0x10", false},
+		{"NaN", false},
+		{"Infinity", false},
+		{"1 2", false},
+	}
+	for _, test := range tests {
+		if got := isDecimal(test.s); got != test.want {
+			t.Error("for", strconv.Quote(test.s), "expected", test.want, "got", got)
+		}
+	}
+}
+
+func TestCoerceScalar(t *testing.T) {
+	tests := []struct {
+		av     dynamodb.AttributeValue
+		to     dynamodb.ScalarAttributeType
+		want   dynamodb.AttributeValue
+		coerce bool
+	}{
+		{ddbconv.EncodeString(" 12 "), dynamodb.ScalarAttributeTypeN, dynamodb.AttributeValue{N: aws.String("12")}, true},
+		{ddbconv.EncodeString("1.5e3"), dynamodb.ScalarAttributeTypeN, dynamodb.AttributeValue{N: aws.String("1.5e3")},
+			true},
+		{ddbconv.EncodeString("twelve"), dynamodb.ScalarAttributeTypeN, ddbconv.EncodeString("twelve"), false},
+		{ddbconv.EncodeInt(12), dynamodb.ScalarAttributeTypeS, ddbconv.EncodeString("12"), true},
+		{ddbconv.EncodeInt(12), dynamodb.ScalarAttributeTypeN, ddbconv.EncodeInt(12), false},
+		{ddbconv.EncodeString("12"), dynamodb.ScalarAttributeTypeS, ddbconv.EncodeString("12"), false},
+		{ddbconv.EncodeBinary([]byte("12")), dynamodb.ScalarAttributeTypeN, ddbconv.EncodeBinary([]byte("12")), false},
+		{ddbconv.EncodeInt(12), dynamodb.ScalarAttributeTypeB, ddbconv.EncodeInt(12), false},
+	}
+	for _, test := range tests {
+		got, coerced := coerceScalar(test.av, test.to)
+		if coerced != test.coerce || !reflect.DeepEqual(got, test.want) {
+			t.Error("for", test.av, test.to, "expected", test.want, test.coerce, "got", got, coerced)
+		}
+	}
+}
+
+func TestDiffItems(t *testing.T) {
+	oldItem := Item{
+		"Id":      ddbconv.EncodeString("a"),
+		"Count":   ddbconv.EncodeInt(1),
+		"Price":   dynamodb.AttributeValue{N: aws.String("1.50")},
+		"Tags":    dynamodb.AttributeValue{SS: []string{"x", "y"}},
+		"Scores":  dynamodb.AttributeValue{NS: []string{"1", "2.0"}},
+		"Blobs":   dynamodb.AttributeValue{BS: [][]byte{{1}, {2}}},
+		"Profile": dynamodb.AttributeValue{M: map[string]dynamodb.AttributeValue{"Name": ddbconv.EncodeString("n")}},
+		"List":    dynamodb.AttributeValue{L: []dynamodb.AttributeValue{ddbconv.EncodeInt(1), ddbconv.EncodeInt(2)}},
+		"Nested": dynamodb.AttributeValue{M: map[string]dynamodb.AttributeValue{
+			"Inner": {M: map[string]dynamodb.AttributeValue{"N": {N: aws.String("10")}}}}},
+		"Gone": ddbconv.EncodeString("g"),
+		"Also": ddbconv.EncodeString("g"),
+	}
+	newItem := Item{
+		"Id":      ddbconv.EncodeString("a"),
+		"Count":   ddbconv.EncodeInt(2),
+		"Price":   dynamodb.AttributeValue{N: aws.String("1.5")},
+		"Tags":    dynamodb.AttributeValue{SS: []string{"y", "x"}},
+		"Scores":  dynamodb.AttributeValue{NS: []string{"2", "1e0"}},
+		"Blobs":   dynamodb.AttributeValue{BS: [][]byte{{2}, {3}}},
+		"Profile": dynamodb.AttributeValue{M: map[string]dynamodb.AttributeValue{"Name": ddbconv.EncodeString("m")}},
+		"List":    dynamodb.AttributeValue{L: []dynamodb.AttributeValue{ddbconv.EncodeInt(2), ddbconv.EncodeInt(1)}},
+		"Nested": dynamodb.AttributeValue{M: map[string]dynamodb.AttributeValue{
+			"Inner": {M: map[string]dynamodb.AttributeValue{"N": {N: aws.String("1e1")}}}}},
+		"New": ddbconv.EncodeBool(true),
+	}
+	set, remove := DiffItems(oldItem, newItem)
+	var setNames []string
+	for name := range set {
+		setNames = append(setNames, name)
+	}
+	sort.Strings(setNames)
+	if want := []string{"Blobs", "Count", "List", "New", "Profile"}; !reflect.DeepEqual(setNames, want) {
+		t.Error("expected set", want, "got", setNames)
+	}
+	if want := []string{"Also", "Gone"}; !reflect.DeepEqual(remove, want) {
+		t.Error("expected remove", want, "got", remove)
+	}
+	if !reflect.DeepEqual(set["Profile"], newItem["Profile"]) {
+		t.Error("expected", newItem["Profile"], "got", set["Profile"])
+	}
+
+	set, remove = DiffItems(oldItem, oldItem)
+	if len(set) != 0 || len(remove) != 0 {
+		t.Error("expected no differences, got", set, remove)
+	}
+	// values of different types are never equal, even if they hold the same text
+	set, _ = DiffItems(Item{"V": ddbconv.EncodeString("1")}, Item{"V": ddbconv.EncodeInt(1)})
+	if len(set) != 1 {
+		t.Error("expected a changed type to be set, got", set)
+	}
+}
+
+func TestProjectPaths(t *testing.T) {
+	name := ddbconv.EncodeString("n")
+	profile := dynamodb.AttributeValue{M: map[string]dynamodb.AttributeValue{
+		"name":    name,
+		"age":     ddbconv.EncodeInt(3),
+		"address": {M: map[string]dynamodb.AttributeValue{"city": ddbconv.EncodeString("c")}},
+	}}
+	tags := dynamodb.AttributeValue{L: []dynamodb.AttributeValue{ddbconv.EncodeString("x")}}
+	item := Item{
+		"id":      ddbconv.EncodeString("a"),
+		"profile": profile,
+		"tags":    tags,
+		"a.b":     ddbconv.EncodeString("dotted"),
+		"tags[0]": ddbconv.EncodeString("named"),
+	}
+	tests := []struct {
+		attrs []string
+		want  Item
+	}{
+		{[]string{"id"}, Item{"id": item["id"]}},
+		{[]string{"missing"}, Item{}},
+		{[]string{"profile.name"}, Item{"profile": {M: map[string]dynamodb.AttributeValue{"name": name}}}},
+		{[]string{"profile.address.city"}, Item{"profile": {M: map[string]dynamodb.AttributeValue{
+			"address": {M: map[string]dynamodb.AttributeValue{"city": ddbconv.EncodeString("c")}}}}}},
+		{[]string{"profile.name", "profile.age"}, Item{"profile": {M: map[string]dynamodb.AttributeValue{
+			"name": name, "age": ddbconv.EncodeInt(3)}}}},
+		{[]string{"profile", "profile.name"}, Item{"profile": profile}},
+		{[]string{"profile.missing"}, Item{}},
+		{[]string{"id.name"}, Item{}},
+		{[]string{"a.b"}, Item{"a.b": item["a.b"]}},
+		{[]string{"tags[0]"}, Item{"tags[0]": item["tags[0]"]}},
+		{[]string{"tags[1]"}, Item{}},
+		{[]string{"profile.address[0]"}, Item{}},
+	}
+	for _, test := range tests {
+		if got := item.Project(test.attrs...); !reflect.DeepEqual(got, test.want) {
+			t.Error("for", test.attrs, "expected", test.want, "got", got)
+		}
+	}
+	if len(profile.M) != 3 {
+		t.Error("expected projection not to change the item, got", profile)
+	}
+}
@@ -0,0 +1,79 @@
+package ddbmap
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/expression"
+	"github.com/shawnsmithdev/ddbmap/ddbconv"
+	"time"
+)
+
+const (
+	// DefaultLeaseOwnerName is used if the lease owner attribute name is not set.
+	DefaultLeaseOwnerName = "LeaseOwner"
+	// DefaultLeaseExpiryName is used if the lease expiry attribute name is not set.
+	DefaultLeaseExpiryName = "LeaseExpiry"
+)
+
+func (tc TableConfig) leaseOwnerName() string {
+	if tc.LeaseOwnerName == "" {
+		return DefaultLeaseOwnerName
+	}
+	return tc.LeaseOwnerName
+}
+
+func (tc TableConfig) leaseExpiryName() string {
+	if tc.LeaseExpiryName == "" {
+		return DefaultLeaseExpiryName
+	}
+	return tc.LeaseExpiryName
+}
+
+// AcquireLease takes a lease on the item with the same key(s) as the given key for the given owner,
+// such as to use the item as a distributed lock. The lease is taken if the item has no lease,
+// if its lease has expired, or if it is already held by the same owner, in which case it is renewed.
+// Returns true if the lease was taken, and false if it is held by another owner.
+// The owner and expiry are set in the LeaseOwnerName and LeaseExpiryName attributes,
+// and the item is created if it does not exist. Other attributes are not changed.
+// As the expiry is Unix time in seconds, the lease expiry attribute can also be the TimeToLiveName of the table,
+// so that abandoned lease items are eventually deleted.
+// Clocks of the lease owners should be synchronized, as the expiry is set and checked using their current time.
+func (d *DynamoMap) AcquireLease(key Itemable, owner string, ttl time.Duration) (bool, error) {
+	if owner == "" {
+		return false, errors.New("lease owner must not be empty")
+	}
+	ownerName, expiryName := expression.Name(d.leaseOwnerName()), expression.Name(d.leaseExpiryName())
+	now := d.now()
+	update := expression.Set(ownerName, expression.Value(owner)).
+		Set(expiryName, exprValue(ddbconv.EncodeInt64(now.Add(ttl).Unix())))
+	condition := expression.Or(ownerName.AttributeNotExists(),
+		expiryName.LessThan(exprValue(ddbconv.EncodeInt64(now.Unix()))),
+		ownerName.Equal(expression.Value(owner)))
+	return d.updateLease(key, update, condition)
+}
+
+// ReleaseLease removes the lease on the item with the same key(s) as the given key, if it is held by the given owner,
+// even if it has expired. Returns true if the lease was released, and false if it is not held by the owner.
+// The item itself is not deleted.
+func (d *DynamoMap) ReleaseLease(key Itemable, owner string) (bool, error) {
+	ownerName := expression.Name(d.leaseOwnerName())
+	update := expression.Remove(ownerName).Remove(expression.Name(d.leaseExpiryName()))
+	return d.updateLease(key, update, ownerName.Equal(expression.Value(owner)))
+}
+
+// updateLease updates the lease attributes of an item, returning false if the condition failed.
+func (d *DynamoMap) updateLease(key Itemable, update expression.UpdateBuilder,
+	condition expression.ConditionBuilder) (bool, error) {
+	input, err := d.updateInput(key.AsItem(), update, &condition)
+	if err != nil {
+		return false, err
+	}
+	if _, err = d.update(context.Background(), input); err != nil {
+		if dynamodb.ErrCodeConditionalCheckFailedException == getErrCode(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
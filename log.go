@@ -1,35 +1,108 @@
 package ddbmap
 
 import (
+	"errors"
+	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"io"
 	"log"
+	"strings"
 )
 
+// RequestError is returned when a DynamoDB request fails. It wraps the error returned by the AWS SDK,
+// adding details useful for troubleshooting, such as when filing an AWS support case.
+// Use errors.As to get a *RequestError from a returned error.
+type RequestError struct {
+	// Operation is the name of the DynamoDB API operation, such as PutItem.
+	Operation string
+	// RequestID is the AWS request ID, which may be empty if no response was received.
+	RequestID string
+	// Code is the AWS error code, such as ConditionalCheckFailedException, or empty if there is none.
+	Code string
+	// Retries is how many times the request was retried before failing.
+	Retries int
+	// Err is the error returned by the AWS SDK.
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("ddbmap: %s request %s failed after %d retries: %v", e.Operation, e.RequestID, e.Retries, e.Err)
+}
+
+// Unwrap returns the error returned by the AWS SDK.
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// requestError wraps an error from sending a request in a RequestError, or returns nil if there is no error.
+func requestError(op string, req *aws.Request, err error) error {
+	if err == nil {
+		return nil
+	}
+	result := &RequestError{Operation: op, Code: getErrCode(err), Err: err}
+	if req != nil {
+		result.RequestID = req.RequestID
+		result.Retries = req.RetryCount
+	}
+	return result
+}
+
 func logErr(err error, logger aws.LoggerFunc) {
-	e := err
+	logger(err.Error())
 	for {
-		logger(e.Error())
-		if aerr, ok := e.(awserr.Error); ok {
-			if aerr.OrigErr() == nil {
-				return
-			}
-			logger("caused by:")
-			e = aerr.OrigErr()
-		} else {
+		var aerr awserr.Error
+		if !errors.As(err, &aerr) || aerr.OrigErr() == nil {
 			return
 		}
+		logger("caused by:")
+		err = aerr.OrigErr()
+		logger(err.Error())
 	}
 }
 
 func getErrCode(err error) string {
-	if aerr, ok := err.(awserr.Error); ok {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
 		return aerr.Code()
 	}
 	return ""
 }
 
+// retryableErrCodes are the codes of errors from requests that may succeed if sent again later.
+var retryableErrCodes = map[string]bool{
+	dynamodb.ErrCodeProvisionedThroughputExceededException: true,
+	dynamodb.ErrCodeRequestLimitExceeded:                   true,
+	dynamodb.ErrCodeInternalServerError:                    true,
+	dynamodb.ErrCodeTransactionConflictException:           true,
+	"ThrottlingException":                                  true,
+	"ServiceUnavailable":                                   true,
+}
+
+// IsRetryable returns true if the error is from a request that failed due to throttling or a server error,
+// and so may succeed if sent again later. Other errors, such as validation errors, are not retryable.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if retryableErrCodes[getErrCode(err)] {
+		return true
+	}
+	var failure awserr.RequestFailure
+	return errors.As(err, &failure) && failure.StatusCode() >= 500
+}
+
+// isConditionCanceled returns true if the error is from a transaction canceled because a condition check failed.
+func isConditionCanceled(err error) bool {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return aerr.Code() == dynamodb.ErrCodeTransactionCanceledException &&
+			strings.Contains(aerr.Message(), "ConditionalCheckFailed")
+	}
+	return false
+}
+
 // Only use if documented to panic or when err can only be due to a library bug
 func forbidErr(err error, logger aws.LoggerFunc) {
 	if err != nil {
@@ -0,0 +1,112 @@
+package ddbmap
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// NameMapper converts the name of a Go struct field into the name of the attribute it is stored as,
+// such as SnakeCase.
+type NameMapper func(goName string) string
+
+// SnakeCase is a NameMapper that converts a Go field name into snake case, such as UserID into user_id.
+func SnakeCase(goName string) string {
+	runes := []rune(goName)
+	var result strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// start a new word after a lower case letter or digit, or before the last upper case letter of an acronym
+			if i > 0 && (!unicode.IsUpper(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				result.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		result.WriteRune(r)
+	}
+	return result.String()
+}
+
+// fieldNames returns the mapped attribute names of the exported fields of a struct type, or its pointer type,
+// keyed by field name. Fields named by a dynamodbav or json tag are not included, nor are fields of other types.
+func (m NameMapper) fieldNames(t reflect.Type) map[string]string {
+	if t == nil {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	result := make(map[string]string)
+	m.addFieldNames(t, result)
+	return result
+}
+
+func (m NameMapper) addFieldNames(t reflect.Type, names map[string]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if tagName(field, "dynamodbav") != "" || tagName(field, "json") != "" {
+			continue
+		}
+		if field.Anonymous {
+			// fields of embedded structs are marshalled as if they were fields of the outer struct
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				m.addFieldNames(embedded, names)
+				continue
+			}
+		}
+		if field.PkgPath == "" { // exported
+			names[field.Name] = m(field.Name)
+		}
+	}
+}
+
+func tagName(field reflect.StructField, key string) string {
+	tag := field.Tag.Get(key)
+	if i := strings.IndexByte(tag, ','); i >= 0 {
+		tag = tag[:i]
+	}
+	return tag
+}
+
+// renameAttributes returns a copy of the item with any attributes named in renames renamed.
+func renameAttributes(item Item, renames map[string]string) Item {
+	if len(renames) == 0 {
+		return item
+	}
+	result := make(Item, len(item))
+	for name, av := range item {
+		if renamed, ok := renames[name]; ok {
+			name = renamed
+		}
+		result[name] = av
+	}
+	return result
+}
+
+// mapNames renames attributes of an item marshalled from val from field names to mapped names.
+func (m NameMapper) mapNames(item Item, val interface{}) Item {
+	if m == nil {
+		return item
+	}
+	return renameAttributes(item, m.fieldNames(reflect.TypeOf(val)))
+}
+
+// unmapNames renames attributes of an item to be unmarshalled into dest from mapped names to field names.
+func (m NameMapper) unmapNames(item Item, dest interface{}) Item {
+	if m == nil {
+		return item
+	}
+	names := m.fieldNames(reflect.TypeOf(dest))
+	inverse := make(map[string]string, len(names))
+	for field, mapped := range names {
+		inverse[mapped] = field
+	}
+	return renameAttributes(item, inverse)
+}
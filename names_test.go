@@ -0,0 +1,29 @@
+package ddbmap
+
+import "testing"
+
+func TestSnakeCase(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"", ""},
+		{"ID", "id"},
+		{"Name", "name"},
+		{"UserID", "user_id"},
+		{"userName", "user_name"},
+		{"HTTPServer", "http_server"},
+		{"ServeHTTP", "serve_http"},
+		{"JSONToXML", "json_to_xml"},
+		{"UserID2", "user_id2"},
+		{"Address2Line", "address2_line"},
+		{"A", "a"},
+		{"AB", "ab"},
+		{"already_snake", "already_snake"},
+		{"ÜberName", "über_name"},
+	}
+	for _, test := range tests {
+		if got := SnakeCase(test.name); got != test.want {
+			t.Error("for", test.name, "expected", test.want, "got", got)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package ddbmap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/expression"
+	"github.com/shawnsmithdev/ddbmap/ddbconv"
+	"sync"
+	"time"
+)
+
+// QueryOptions control which items are read by a query, and in what order.
+type QueryOptions struct {
+	// If true, items are read in descending range key order, newest first for time-ordered range keys.
+	// Otherwise items are read in ascending range key order.
+	Descending bool
+	// The maximum number of items to read. If less than 1, every item with the hash key is read.
+	Limit int
+	// If not nil, only items with a range key matching this condition are read.
+	RangeCondition RangeCondition
+}
+
+// RangeCondition builds a key condition on the range key of a table, such as
+//
+//	func(rangeKey expression.KeyBuilder) expression.KeyConditionBuilder {
+//	    return rangeKey.BeginsWith("2019-")
+//	}
+type RangeCondition func(expression.KeyBuilder) expression.KeyConditionBuilder
+
+// QueryItems calls the given consumer for each stored item with the same hash key as the given item,
+// in range key order. Iteration stops if the given function returns false.
+func (d *DynamoMap) QueryItems(hashKey Itemable, opts QueryOptions, consumer func(Item) bool) error {
+	input, err := d.queryInput(hashKey, opts.RangeCondition)
+	if err != nil {
+		return err
+	}
+	input.ScanIndexForward = aws.Bool(!opts.Descending)
+	return d.query(input, opts.Limit, consumer)
+}
+
+// query calls the given consumer for each item read by a query with the given input, reading every page,
+// until limit items are read, if limit is positive. Iteration stops if the given function returns false.
+func (d *DynamoMap) query(input *dynamodb.QueryInput, limit int, consumer func(Item) bool) error {
+	remaining := limit
+	for {
+		if limit > 0 {
+			input.Limit = aws.Int64(int64(remaining))
+		}
+		d.debug("query request input:", input)
+		req := d.reader().QueryRequest(input)
+		sendCtx, end := d.startSpan(context.Background(), "Query", nil)
+		resp, err := req.Send(sendCtx)
+		err = requestError("Query", req.Request, err)
+		d.onRequestError(err)
+		end(err)
+		d.debug("query response:", resp, ", error:", err)
+		if err != nil {
+			return err
+		}
+		d.reportCapacityOf("query", resp.ConsumedCapacity)
+		for _, item := range resp.Items {
+			decoded, err := d.decodeItem(item)
+			if err != nil {
+				return err
+			}
+			if !consumer(decoded) {
+				return nil
+			}
+		}
+		remaining -= len(resp.Items)
+		if resp.LastEvaluatedKey == nil || (limit > 0 && remaining <= 0) {
+			return nil
+		}
+		input.ExclusiveStartKey = resp.LastEvaluatedKey
+	}
+}
+
+// QueryCount returns the number of stored items with the same hash key as the given item.
+// Items are counted by DynamoDB without being returned, but every item read still consumes read capacity.
+func (d *DynamoMap) QueryCount(hashKey Itemable) (int64, error) {
+	return d.QueryCountRange(hashKey, nil)
+}
+
+// QueryCountRange returns the number of stored items with the same hash key as the given item,
+// and a range key matching rangeCond, or every such item if rangeCond is nil.
+func (d *DynamoMap) QueryCountRange(hashKey Itemable, rangeCond RangeCondition) (int64, error) {
+	input, err := d.queryInput(hashKey, rangeCond)
+	if err != nil {
+		return 0, err
+	}
+	input.Select = dynamodb.SelectCount
+	var count int64
+	for {
+		d.debug("query count request input:", input)
+		req := d.reader().QueryRequest(input)
+		sendCtx, end := d.startSpan(context.Background(), "Query", nil)
+		resp, err := req.Send(sendCtx)
+		err = requestError("Query", req.Request, err)
+		d.onRequestError(err)
+		end(err)
+		d.debug("query count response:", resp, ", error:", err)
+		if err != nil {
+			return count, err
+		}
+		d.reportCapacityOf("query count", resp.ConsumedCapacity)
+		count += aws.Int64Value(resp.Count)
+		if resp.LastEvaluatedKey == nil {
+			return count, nil
+		}
+		input.ExclusiveStartKey = resp.LastEvaluatedKey
+	}
+}
+
+// RecentItems returns the items of a global secondary index partition with a range key after the given time,
+// oldest first, such as to poll an outbox for new events with an index of a constant hash key and a timestamp range key.
+// The partition is the value of the index hash key. The index range key must hold Unix time in seconds as a Number (N),
+// or a time in the RFC3339 format in UTC as a String (S), which sorts in time order.
+// At most limit items are returned, unless limit is less than 1. Index reads are eventually consistent.
+func (d *DynamoMap) RecentItems(indexName string, partition dynamodb.AttributeValue, since time.Time,
+	limit int) ([]Item, error) {
+	hashKey, rangeKey, rangeType, err := d.indexKeySchema(indexName)
+	if err != nil {
+		return nil, err
+	}
+	var sinceValue dynamodb.AttributeValue
+	switch rangeType {
+	case dynamodb.ScalarAttributeTypeN:
+		sinceValue = ddbconv.EncodeInt64(since.Unix())
+	case dynamodb.ScalarAttributeTypeS:
+		sinceValue = ddbconv.EncodeString(since.UTC().Format(time.RFC3339))
+	default:
+		return nil, fmt.Errorf("index %v range key is not a time, type: %v", indexName, rangeType)
+	}
+	keyCond := expression.Key(hashKey).Equal(exprValue(partition)).
+		And(expression.Key(rangeKey).GreaterThan(exprValue(sinceValue)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, err
+	}
+	input := &dynamodb.QueryInput{
+		TableName:                 &d.TableName,
+		IndexName:                 &indexName,
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ScanIndexForward:          aws.Bool(true),
+		ReturnConsumedCapacity:    d.returnCapacity(),
+	}
+	var result []Item
+	err = d.query(input, limit, func(item Item) bool {
+		result = append(result, item)
+		return true
+	})
+	return result, err
+}
+
+// indexKeySchema returns the hash and range key names of the given global secondary index,
+// and the type of its range key, from the table description.
+func (d *DynamoMap) indexKeySchema(indexName string) (hashKey, rangeKey string,
+	rangeType dynamodb.ScalarAttributeType, err error) {
+	table, cached := d.cachedDescription()
+	if !cached {
+		if table, err = d.describeTable(context.Background()); err != nil {
+			return "", "", "", err
+		}
+	}
+	for _, index := range table.GlobalSecondaryIndexes {
+		if aws.StringValue(index.IndexName) != indexName {
+			continue
+		}
+		for _, key := range index.KeySchema {
+			if key.KeyType == dynamodb.KeyTypeHash {
+				hashKey = aws.StringValue(key.AttributeName)
+			} else {
+				rangeKey = aws.StringValue(key.AttributeName)
+			}
+		}
+		if rangeKey == "" {
+			return "", "", "", fmt.Errorf("index has no range key: %v", indexName)
+		}
+		for _, attr := range table.AttributeDefinitions {
+			if aws.StringValue(attr.AttributeName) == rangeKey {
+				rangeType = attr.AttributeType
+			}
+		}
+		return hashKey, rangeKey, rangeType, nil
+	}
+	return "", "", "", fmt.Errorf("no such global secondary index: %v", indexName)
+}
+
+// RangeByPartition calls the given consumer with the items of each partition of the table,
+// which are the items with the same hash key, in range key order. Distinct hash keys are first found
+// by scanning only the hash key attribute, and then each partition is read with a query,
+// so every distinct hash key is held in memory, as are the items of each partition while passed to the consumer.
+// Partitions are read in no particular order. Items stored or deleted while iterating may not be included,
+// and partitions with no items left when queried are skipped. Iteration stops if the consumer returns false.
+func (d *DynamoMap) RangeByPartition(consumer func(hashKey dynamodb.AttributeValue, items []Item) bool) error {
+	expr, err := expression.NewBuilder().
+		WithProjection(expression.NamesList(expression.Name(d.HashKeyName))).
+		Build()
+	if err != nil {
+		return err
+	}
+	input := d.scanInput()
+	input.Select = dynamodb.SelectSpecificAttributes
+	input.ProjectionExpression = expr.Projection()
+	input.ExpressionAttributeNames = expr.Names()
+
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	var hashKeys []Item
+	err = d.rangeItems(context.Background(), input, func(item Item) error {
+		key := item.Project(d.HashKeyName)
+		id := key.keyString()
+		mu.Lock()
+		defer mu.Unlock()
+		if !seen[id] {
+			seen[id] = true
+			hashKeys = append(hashKeys, key)
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range hashKeys {
+		var items []Item
+		err = d.QueryItems(key, QueryOptions{}, func(item Item) bool {
+			items = append(items, item)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if len(items) > 0 && !consumer(key[d.HashKeyName], items) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// QueryPage reads one page of at most limit items with the same hash key as the given item, in range key order.
+// If rangeCond is not nil, only items with a range key matching it are read.
+// The returned token can be passed to a later call to read the next page, and is nil if there are no more pages.
+// Pass a nil token to read the first page.
+func (d *DynamoMap) QueryPage(hashKey Itemable, rangeCond RangeCondition, token []byte, limit int) ([]Item, []byte, error) {
+	if limit < 1 {
+		return nil, nil, fmt.Errorf("query page limit must be positive: %d", limit)
+	}
+	input, err := d.queryInput(hashKey, rangeCond)
+	if err != nil {
+		return nil, nil, err
+	}
+	input.Limit = aws.Int64(int64(limit))
+	if len(token) > 0 {
+		if err := json.Unmarshal(token, &input.ExclusiveStartKey); err != nil {
+			return nil, nil, fmt.Errorf("invalid query page token: %w", err)
+		}
+	}
+	d.debug("query request input:", input)
+	req := d.reader().QueryRequest(input)
+	sendCtx, end := d.startSpan(context.Background(), "Query", nil)
+	resp, err := req.Send(sendCtx)
+	err = requestError("Query", req.Request, err)
+	d.onRequestError(err)
+	end(err)
+	d.debug("query response:", resp, ", error:", err)
+	if err != nil {
+		return nil, nil, err
+	}
+	d.reportCapacityOf("query", resp.ConsumedCapacity)
+	items := make([]Item, 0, len(resp.Items))
+	for _, item := range resp.Items {
+		decoded, err := d.decodeItem(item)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, decoded)
+	}
+	var next []byte
+	if resp.LastEvaluatedKey != nil {
+		if next, err = json.Marshal(resp.LastEvaluatedKey); err != nil {
+			return nil, nil, err
+		}
+	}
+	return items, next, nil
+}
+
+// queryInput creates the input to query items with the same hash key as the given item,
+// and a range key matching rangeCond, if not nil.
+func (d *DynamoMap) queryInput(hashKey Itemable, rangeCond RangeCondition) (*dynamodb.QueryInput, error) {
+	hashValue, ok := hashKey.AsItem()[d.HashKeyName]
+	if !ok {
+		return nil, fmt.Errorf("query missing hash key attribute: %v", d.HashKeyName)
+	}
+	keyCond := expression.Key(d.HashKeyName).Equal(exprValue(hashValue))
+	if rangeCond != nil {
+		if !d.Ranged() {
+			return nil, fmt.Errorf("range condition on table without range key: %v", d.TableName)
+		}
+		keyCond = keyCond.And(rangeCond(expression.Key(d.RangeKeyName)))
+	}
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.QueryInput{
+		TableName:                 &d.TableName,
+		ConsistentRead:            &d.ReadWithStrongConsistency,
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ReturnConsumedCapacity:    d.returnCapacity(),
+	}, nil
+}
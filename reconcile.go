@@ -0,0 +1,156 @@
+package ddbmap
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// ReconcileTable updates an existing table to match the table options of this map.
+// The provisioned read and write capacity are set to CreateTableReadCapacity and CreateTableWriteCapacity,
+// unless they are less than 1 or the table uses on-demand capacity. Server side encryption is enabled if
+// ServerSideEncryption is set, point in time recovery is enabled if PointInTimeRecovery is set,
+// and TimeToLive is enabled if TimeToLiveDuration is set. Security settings are never disabled by reconciling.
+// Each change waits for the table to become active again before continuing.
+func (d *DynamoMap) ReconcileTable() error {
+	table, err := d.describeTable(context.Background())
+	if err != nil {
+		return err
+	}
+
+	provisioned := table.BillingModeSummary == nil ||
+		table.BillingModeSummary.BillingMode != dynamodb.BillingModePayPerRequest
+	if current := table.ProvisionedThroughput; provisioned && current != nil {
+		read, write := aws.Int64Value(current.ReadCapacityUnits), aws.Int64Value(current.WriteCapacityUnits)
+		if d.CreateTableReadCapacity > 0 {
+			read = int64(d.CreateTableReadCapacity)
+		}
+		if d.CreateTableWriteCapacity > 0 {
+			write = int64(d.CreateTableWriteCapacity)
+		}
+		if read != aws.Int64Value(current.ReadCapacityUnits) || write != aws.Int64Value(current.WriteCapacityUnits) {
+			d.log("updating table throughput, read:", read, ", write:", write)
+			err = d.updateTable(&dynamodb.UpdateTableInput{
+				TableName: &d.TableName,
+				ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+					ReadCapacityUnits:  &read,
+					WriteCapacityUnits: &write,
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	sseEnabled := table.SSEDescription != nil && (table.SSEDescription.Status == dynamodb.SSEStatusEnabled ||
+		table.SSEDescription.Status == dynamodb.SSEStatusEnabling)
+	if d.ServerSideEncryption && !sseEnabled {
+		d.log("enabling table server side encryption")
+		err = d.updateTable(&dynamodb.UpdateTableInput{
+			TableName:        &d.TableName,
+			SSESpecification: &dynamodb.SSESpecification{Enabled: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.PointInTimeRecovery {
+		if err = d.EnablePITR(); err != nil {
+			return err
+		}
+	}
+
+	_, err = d.EnableTTL()
+	return err
+}
+
+// EnablePITR enables point in time recovery (PITR) on the table, using UpdateContinuousBackups,
+// so the table can be restored to any second in the last 35 days. Nothing changes if it is already enabled.
+// If continuous backups are not yet available, such as for a table that just became active,
+// the request is sent again after waiting, as configured by PollInterval and MaxPollInterval.
+func (d *DynamoMap) EnablePITR() error {
+	return d.enablePITR(context.Background())
+}
+
+func (d *DynamoMap) enablePITR(ctx context.Context) error {
+	input := &dynamodb.UpdateContinuousBackupsInput{
+		TableName: &d.TableName,
+		PointInTimeRecoverySpecification: &dynamodb.PointInTimeRecoverySpecification{
+			PointInTimeRecoveryEnabled: aws.Bool(true),
+		},
+	}
+	for attempt := 0; ; attempt++ {
+		d.debug("update continuous backups request input:", input)
+		req := d.Client.UpdateContinuousBackupsRequest(input)
+		sendCtx, end := d.startSpan(ctx, "UpdateContinuousBackups", nil)
+		resp, err := req.Send(sendCtx)
+		err = requestError("UpdateContinuousBackups", req.Request, err)
+		end(err)
+		d.debug("update continuous backups response:", resp, ", error:", err)
+		if dynamodb.ErrCodeContinuousBackupsUnavailableException != getErrCode(err) {
+			return err
+		}
+		d.log("waiting for continuous backups to be available")
+		if err = d.pollWait(ctx, attempt); err != nil {
+			return err
+		}
+	}
+}
+
+// ApproxCount returns the approximate number of items in the table, as reported by DescribeTable.
+// DynamoDB updates this count about every six hours, so recent changes may not be reflected.
+// Unlike counting items with a scan, it consumes no read capacity.
+func (d *DynamoMap) ApproxCount() (int64, error) {
+	table, err := d.describeTable(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	return aws.Int64Value(table.ItemCount), nil
+}
+
+// describeTable returns the current description of the table, which is also cached if DescribeCacheTTL is set.
+func (d *DynamoMap) describeTable(ctx context.Context) (*dynamodb.TableDescription, error) {
+	input := &dynamodb.DescribeTableInput{TableName: &d.TableName}
+	d.debug("describe table request input:", input)
+	req := d.Client.DescribeTableRequest(input)
+	sendCtx, end := d.startSpan(ctx, "DescribeTable", nil)
+	resp, err := req.Send(sendCtx)
+	err = requestError("DescribeTable", req.Request, err)
+	d.onRequestError(err)
+	end(err)
+	d.debug("describe table response:", resp, ", error:", err)
+	if err != nil {
+		return nil, err
+	}
+	d.cacheDescription(resp.Table)
+	return resp.Table, nil
+}
+
+// updateTable sends an UpdateTable request, then waits for the table to become active.
+func (d *DynamoMap) updateTable(input *dynamodb.UpdateTableInput) error {
+	d.debug("update table request input:", input)
+	req := d.Client.UpdateTableRequest(input)
+	sendCtx, end := d.startSpan(context.Background(), "UpdateTable", nil)
+	resp, err := req.Send(sendCtx)
+	err = requestError("UpdateTable", req.Request, err)
+	end(err)
+	d.debug("update table response:", resp, ", error:", err)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		table, err := d.describeTable(context.Background())
+		if err != nil {
+			return err
+		}
+		if table.TableStatus == dynamodb.TableStatusActive {
+			return nil
+		}
+		d.log("waiting for status:", table.TableStatus)
+		if err = d.pollWait(context.Background(), attempt); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package ddbmap
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/shawnsmithdev/ddbmap/ddbconv"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStoreDoesNotChangeGivenItem(t *testing.T) {
+	var mu sync.Mutex
+	var sent []Item
+	client, closeServer := fakeDynamo(t, func(op string, body []byte) interface{} {
+		var input dynamodb.PutItemInput
+		if op != "PutItem" || json.Unmarshal(body, &input) != nil {
+			t.Error("unexpected request", op, string(body))
+			return fakeDynamoError{Code: "ValidationException", Message: "unexpected request"}
+		}
+		mu.Lock()
+		sent = append(sent, input.Item)
+		mu.Unlock()
+		if input.ConditionExpression != nil {
+			return fakeDynamoError{Code: dynamodb.ErrCodeConditionalCheckFailedException, Message: "exists"}
+		}
+		return dynamodb.PutItemOutput{}
+	})
+	defer closeServer()
+	created := time.Unix(1500000000, 0)
+	d := &DynamoMap{TableConfig: TableConfig{
+		TableName:          "Test",
+		HashKeyName:        "Id",
+		TimeToLiveDuration: time.Hour,
+		CreatedAtName:      "Created",
+		UpdatedAtName:      "Updated",
+		Clock:              func() time.Time { return created.Add(time.Minute) },
+	}, Client: client}
+
+	item := Item{"Id": ddbconv.EncodeString("a"), "Created": ddbconv.EncodeInt64(created.Unix())}
+	want := Item{"Id": ddbconv.EncodeString("a"), "Created": ddbconv.EncodeInt64(created.Unix())}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := d.StoreItem(item); err != nil {
+				t.Error("unexpected error", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if stored, err := d.StoreItemIfAbsent(item); stored || err != nil {
+		t.Error("expected the condition to fail, got", stored, err)
+	}
+	if !reflect.DeepEqual(item, want) {
+		t.Error("expected the given item to be unchanged, got", item)
+	}
+	if len(sent) != 5 {
+		t.Fatal("expected 5 requests, got", len(sent))
+	}
+	if got := ddbconv.DecodeInt64(sent[0]["Created"]); got != created.Unix() {
+		t.Error("expected Store to keep the given created time, got", got)
+	}
+	if got := ddbconv.DecodeInt64(sent[4]["Created"]); got != created.Add(time.Minute).Unix() {
+		t.Error("expected StoreItemIfAbsent to set the created time, got", got)
+	}
+	for _, name := range []string{"Updated", "TTL"} {
+		if _, ok := sent[4][name]; !ok {
+			t.Error("expected", name, "to be sent")
+		}
+	}
+}
+
+func TestStoreItemIfSequenceDoesNotChangeGivenItem(t *testing.T) {
+	var sent Item
+	client, closeServer := fakeDynamo(t, func(op string, body []byte) interface{} {
+		var input dynamodb.PutItemInput
+		if op != "PutItem" || json.Unmarshal(body, &input) != nil {
+			t.Error("unexpected request", op, string(body))
+			return fakeDynamoError{Code: "ValidationException", Message: "unexpected request"}
+		}
+		sent = input.Item
+		return fakeDynamoError{Code: dynamodb.ErrCodeConditionalCheckFailedException, Message: "stale"}
+	})
+	defer closeServer()
+	d := &DynamoMap{TableConfig: TableConfig{TableName: "Test", HashKeyName: "Id"}, Client: client}
+
+	item := Item{"Id": ddbconv.EncodeString("a"), "Seq": ddbconv.EncodeInt(1)}
+	stored, err := d.StoreItemIfSequenceNewer(item, "Seq", ddbconv.EncodeInt(2))
+	if stored || err != nil {
+		t.Error("expected the stale write to be rejected, got", stored, err)
+	}
+	if got := ddbconv.DecodeInt(item["Seq"]); got != 1 {
+		t.Error("expected the given item to be unchanged, got", item)
+	}
+	if got := ddbconv.DecodeInt(sent["Seq"]); got != 2 {
+		t.Error("expected the incoming sequence to be sent, got", sent)
+	}
+}
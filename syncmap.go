@@ -2,6 +2,9 @@ package ddbmap
 
 import "sync"
 
+// interface check
+var _ Map = &syncMap{}
+
 // KeyFromValue is a function that can generate a hashable key from a value.
 type KeyFromValue func(interface{}) (interface{}, error)
 
@@ -55,5 +58,5 @@ func (sm *syncMap) Store(value interface{}) (err error) {
 
 func (sm *syncMap) StoreIfAbsent(value interface{}) (bool, error) {
 	_, loaded, err := sm.LoadOrStore(value)
-	return loaded, err
+	return !loaded && err == nil, err
 }
@@ -1,10 +1,16 @@
 package ddbmap
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"github.com/shawnsmithdev/ddbmap/ddbconv"
+	"math/big"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -22,8 +28,44 @@ type CreateTableOptions struct {
 	HashKeyType dynamodb.ScalarAttributeType
 	// The type of the range key attribute, if any.
 	RangeKeyType dynamodb.ScalarAttributeType
-	// If true, Server Side Encryption (SSE) is enabled.
+	// If true, Server Side Encryption (SSE) is enabled on the new table, and on an existing table by ReconcileTable.
+	// If false, SSE is not disabled on an existing table.
 	ServerSideEncryption bool
+	// If true, point in time recovery (PITR) is enabled on the new table once it is active, as with EnablePITR,
+	// and on an existing table by ReconcileTable. It is never disabled by ddbmap.
+	PointInTimeRecovery bool
+	// The wait before first checking again on a table that is not yet usable, such as one being created.
+	// Each later wait is doubled, up to MaxPollInterval. If zero, DefaultPollInterval is used.
+	PollInterval time.Duration
+	// The longest wait between checks on a table that is not yet usable. If zero, DefaultMaxPollInterval is used.
+	MaxPollInterval time.Duration
+	// If true, NewMap updates an existing table to match these options, as with DynamoMap.ReconcileTable.
+	Reconcile bool
+	// The global secondary indexes to create with the table, if any.
+	GlobalSecondaryIndexes []IndexSpec
+	// If true, stored key attributes are converted to the HashKeyType or RangeKeyType, if set,
+	// when they are a number stored as a string (S) or a string stored as a number (N).
+	// If false, a key attribute with the wrong type causes an error naming the mismatch.
+	CoerceKeyTypes bool
+}
+
+// IndexSpec describes a global secondary index (GSI) to create with a new table.
+type IndexSpec struct {
+	// The name of the index.
+	IndexName string
+	// The name of the index hash key attribute.
+	HashKeyName string
+	// The type of the index hash key attribute.
+	HashKeyType dynamodb.ScalarAttributeType
+	// The name of the index range key attribute, if any.
+	RangeKeyName string
+	// The type of the index range key attribute, if any.
+	RangeKeyType dynamodb.ScalarAttributeType
+	// Which attributes are copied into the index: KEYS_ONLY, INCLUDE, or ALL.
+	// If empty, dynamodb.ProjectionTypeAll is used. Every projected attribute is stored again in the index.
+	ProjectionType dynamodb.ProjectionType
+	// The non-key attributes copied into the index, when ProjectionType is INCLUDE.
+	NonKeyAttributes []string
 }
 
 // TableConfig holds details about a specific DynamoDB table and some options for using it.
@@ -34,53 +76,555 @@ type TableConfig struct {
 	HashKeyName string
 	// The name of the range key attribute, if any.
 	RangeKeyName string
+	// HashKeyBuilder, if not nil, builds the hash key of each item from its other attributes, such as
+	// a composite key like USER#123#ORDER, stored as a String (S). It is set on each item just before it is stored,
+	// replacing any given hash key, and on keys without a hash key, such as those passed to LoadItem,
+	// which must then have the attributes it is built from. Items loaded by LoadItem are checked
+	// against it, returning an error if the stored hash key differs from the one built from the loaded item.
+	HashKeyBuilder func(Item) string
+	// RangeKeyBuilder, if not nil, builds the range key of each item from its other attributes,
+	// as HashKeyBuilder does for the hash key.
+	RangeKeyBuilder func(Item) string
 	// The name of the numeric version field, if any.
 	// Used only for those conditional methods that use versions.
 	VersionName string
 	// The name of the ttl field, if any.
-	// If empty and TimeToLiveDuration is not zero, DefaultTimeToLiveName ("TTL") will be used.
+	// If empty and TimeToLiveDuration is not zero, DefaultTimeToLiveName ("TTL") will be used,
+	// unless RequireTimeToLiveName is true.
 	// A ttl field should be either an int type or dynamodbattribute.UnixTime.
 	TimeToLiveName string
+	// If true, TimeToLiveName must be set if TimeToLiveDuration is not zero, rather than defaulting to
+	// DefaultTimeToLiveName, so the default attribute is never added to items unexpectedly.
+	// Otherwise, NewMap, EnableTTL, and methods that store items return ErrTimeToLiveNameRequired.
+	RequireTimeToLiveName bool
+	// The name of the attribute holding the owner of a lease taken with AcquireLease.
+	// If empty, DefaultLeaseOwnerName ("LeaseOwner") is used.
+	LeaseOwnerName string
+	// The name of the attribute holding the expiry of a lease taken with AcquireLease, as Unix time in seconds.
+	// If empty, DefaultLeaseExpiryName ("LeaseExpiry") is used.
+	LeaseExpiryName string
 	// The Time To Live Duration, if any.
 	TimeToLiveDuration time.Duration
+	// The name of an attribute set to the time an item was first stored, if any, as Unix time in seconds.
+	// It is set when storing an item that does not already have it, and by StoreItemIfAbsent, LoadOrStore,
+	// and similar methods that only store new items. Updates, such as Upsert, set it only if the stored item
+	// does not have it. As Store replaces the whole item, storing a loaded item keeps the time it was created.
+	CreatedAtName string
+	// The name of an attribute set to the time an item was last stored or updated, if any, as Unix time in seconds.
+	UpdatedAtName string
+	// Clock, if not nil, is used instead of time.Now to get the current time, such as when setting ttl fields.
+	// It is not used to measure elapsed time. A fixed clock can make ttl values deterministic in tests.
+	Clock func() time.Time
 	// The concurrency used in table scans (Range calls).
 	// If less than 2, scan is done serially.
 	ScanConcurrency int
+	// The number of segments table scans are split into, which are shared among ScanConcurrency workers,
+	// each scanning one segment at a time. More segments than workers can balance the work of a scan
+	// across workers when some segments take longer than others.
+	// If less than ScanConcurrency, there is one segment per worker.
+	ScanSegments int
+	// If SegmentCount is greater than zero, table scans read only the SegmentCount segments starting at
+	// SegmentOffset, of the ScanSegments segments the table is split into, such as to share a scan among
+	// several processes, each with the same ScanSegments and its own range of segments.
+	// The range must be within ScanSegments. Scans that continue from a key or token are not split.
+	SegmentOffset int
+	// The number of segments read by table scans, starting at SegmentOffset. If zero, every segment is read.
+	SegmentCount int
+	// DescribeCacheTTL, if greater than zero, is how long a table description read by DescribeTable, such as by NewMap,
+	// is cached, so that later maps of the same table in the same region reuse it instead of describing the table again,
+	// such as on each cold start of a serverless function. Descriptions of tables that are being created or deleted
+	// are not cached. Use DynamoMap.ClearDescribeCache to force the table to be described again.
+	DescribeCacheTTL time.Duration
+	// CacheRegion is the region of the table, used to tell apart cached descriptions and key schemas of tables
+	// with the same name in different regions. If empty, the region of Client is used if it is a *dynamodb.Client.
+	// Otherwise, such as for a wrapped client, the region is unknown and nothing is cached.
+	CacheRegion string
+	// If true, items are checked against MaxItemSize before being stored.
+	// Items that are too large are not sent and ErrItemTooLarge is returned.
+	CheckItemSize bool
+	// AttributeCodecs maps the names of binary attributes to codecs that transform them,
+	// such as GzipCodec for compression. Codecs are applied when storing and reversed when loading or scanning.
+	AttributeCodecs map[string]Codec
+	// FieldEncryptor, if not nil, encrypts the attributes named in EncryptedAttributes for client side encryption.
+	// Values of any type are encrypted as they are stored, after any AttributeCodecs are applied, and stored as Binary
+	// (B). They are decrypted as they are loaded, scanned, or queried. Key attributes are never encrypted.
+	// Encrypted attributes cannot be used in conditions, filters, or as the keys of secondary indexes.
+	FieldEncryptor FieldEncryptor
+	// The names of the attributes encrypted with FieldEncryptor.
+	EncryptedAttributes []string
+	// OnScanProgress, if not nil, is called after each page read by a scan worker (Range calls),
+	// with the worker's segment and the number of items it has read so far.
+	// For a serial scan the segment is 0. Parallel scan workers may call it concurrently.
+	OnScanProgress func(segment int, itemsSoFar int64)
+	// CapacityReporter, if not nil, is called with the capacity consumed by each request,
+	// broken down by the table and each secondary index used. Parallel scans may call it concurrently.
+	CapacityReporter func(CapacityReport)
+	// Tracer, if not nil, is used to start a span around each request sent to DynamoDB, such as to integrate with
+	// OpenTelemetry. Spans are started from the context passed to methods that take one.
+	Tracer Tracer
 	// If the client should use strongly consistent reads.
 	// This costs twice as much as eventually consistent reads.
 	ReadWithStrongConsistency bool
+	// If true, and ReadWithStrongConsistency is true, a single item load that is throttled
+	// with ProvisionedThroughputExceededException, after any retries by the client, is sent once more
+	// as an eventually consistent read, which consumes half the read capacity but may not reflect recent writes.
+	FallbackToEventualOnThrottle bool
+	// If true, requests that would store or delete items are logged and skipped, and report success.
+	// Reads, and any table creation or TTL changes, are still sent.
+	DryRun bool
 	// If true, debug logging in this library is enabled.
 	Debug bool
 	// Logger is the logger used by this library for debug and error logging.
 	Logger aws.Logger
+	// Marshaller, if not nil, is used instead of dynamodbattribute.MarshalMap to marshal values
+	// passed to Store, StoreIfAbsent, LoadOrStore, StoreIfVersion, Load, and Delete.
+	// Values that are already an Item or are Itemable are not passed to it.
+	Marshaller ItemMarshaller
+	// EmptyStringBehavior controls how empty strings are marshalled by MarshalItem,
+	// in the attributes of the marshalled item and of any maps nested within it.
+	EmptyStringBehavior EmptyStringBehavior
+	// ZeroValueBehavior controls which zero valued attributes are omitted by MarshalItem,
+	// after empty strings are handled according to EmptyStringBehavior. Key attributes are never omitted.
+	ZeroValueBehavior ZeroValueBehavior
+	// NameMapper, if not nil, converts the names of struct fields into attribute names when marshalling values
+	// with MarshalItem, and back again when unmarshalling items with UnmarshalItem, such as with SnakeCase.
+	// It is not applied to fields named by a dynamodbav or json tag, nor to the fields of nested structs.
+	NameMapper NameMapper
 	// ValueUnmarshaller can be used to change what is returned by Load, LoadOrStore, and Range.
 	// These methods return an Item if ValueUnmarshaller is nil.
 	// If ValueUnmarshaller is not nil, the result of passing the value item to the unmarshaller
 	// is returned as the value instead of the item.
 	ValueUnmarshaller ItemUnmarshaller
+	// KeyValueUnmarshaller, if not nil, is used instead of ValueUnmarshaller, and is also passed the key item,
+	// such as to populate a key struct embedded in the returned value.
+	KeyValueUnmarshaller KeyValueUnmarshaller
 	// Options for creating the table
 	CreateTableOptions
 }
 
+// WithHashKey returns a copy of this config with the given hash key name and type, such as
+//
+//	ddbmap.TableConfig{TableName: "users"}.WithStringHashKey("UserID").WithNumberRangeKey("Created")
+func (tc TableConfig) WithHashKey(name string, keyType dynamodb.ScalarAttributeType) TableConfig {
+	tc.HashKeyName, tc.HashKeyType = name, keyType
+	return tc
+}
+
+// WithStringHashKey returns a copy of this config with the given hash key name and the String (S) type.
+func (tc TableConfig) WithStringHashKey(name string) TableConfig {
+	return tc.WithHashKey(name, dynamodb.ScalarAttributeTypeS)
+}
+
+// WithNumberHashKey returns a copy of this config with the given hash key name and the Number (N) type.
+func (tc TableConfig) WithNumberHashKey(name string) TableConfig {
+	return tc.WithHashKey(name, dynamodb.ScalarAttributeTypeN)
+}
+
+// WithRangeKey returns a copy of this config with the given range key name and type.
+func (tc TableConfig) WithRangeKey(name string, keyType dynamodb.ScalarAttributeType) TableConfig {
+	tc.RangeKeyName, tc.RangeKeyType = name, keyType
+	return tc
+}
+
+// WithStringRangeKey returns a copy of this config with the given range key name and the String (S) type.
+func (tc TableConfig) WithStringRangeKey(name string) TableConfig {
+	return tc.WithRangeKey(name, dynamodb.ScalarAttributeTypeS)
+}
+
+// WithNumberRangeKey returns a copy of this config with the given range key name and the Number (N) type.
+func (tc TableConfig) WithNumberRangeKey(name string) TableConfig {
+	return tc.WithRangeKey(name, dynamodb.ScalarAttributeTypeN)
+}
+
 // Ranged returns true if RangeKeyName is not empty
 func (tc TableConfig) Ranged() bool {
 	return len(tc.RangeKeyName) > 0
 }
 
+// MarshalItem will marshal a value into an Item using the configured Marshaller, if any,
+// or else dynamodbattribute.MarshalMap, unless the value is already an Item, an attribute value map, or is Itemable,
+// in which case it is returned as is, without being marshalled or changed.
+// Empty strings in the marshalled item are handled according to EmptyStringBehavior,
+// attribute names are mapped by NameMapper, if set, and zero values are omitted according to ZeroValueBehavior.
+func (tc TableConfig) MarshalItem(val interface{}) (Item, error) {
+	switch valAsType := val.(type) {
+	case Item:
+		return valAsType, nil
+	case map[string]dynamodb.AttributeValue:
+		return valAsType, nil
+	case Itemable:
+		return valAsType.AsItem(), nil
+	}
+	var item Item
+	var err error
+	switch {
+	case tc.Marshaller != nil:
+		item, err = tc.Marshaller(val)
+	case tc.EmptyStringBehavior != EmptyStringDefault:
+		item, err = marshalKeepingEmptyStrings(val)
+	default:
+		item, err = dynamodbattribute.MarshalMap(val)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tc.EmptyStringBehavior.apply(item)
+	item = tc.NameMapper.mapNames(item, val)
+	tc.ZeroValueBehavior.apply(item, tc.HashKeyName, tc.RangeKeyName)
+	return item, nil
+}
+
+// UnmarshalItem unmarshals an item into dest, which must be a pointer, using dynamodbattribute.UnmarshalMap,
+// after converting any attribute names mapped by NameMapper back into field names.
+func (tc TableConfig) UnmarshalItem(item Item, dest interface{}) error {
+	return dynamodbattribute.UnmarshalMap(tc.NameMapper.unmapNames(item, dest), dest)
+}
+
+// UnmarshallerForType is like the UnmarshallerForType function, but unmarshals items using UnmarshalItem,
+// so it can be used as the ValueUnmarshaller of a table with a NameMapper.
+func (tc TableConfig) UnmarshallerForType(template interface{}) ItemUnmarshaller {
+	return unmarshallerForType(template, tc.UnmarshalItem)
+}
+
+// marshalKeepingEmptyStrings is like dynamodbattribute.MarshalMap, but marshals empty strings as empty strings,
+// instead of NULL.
+func marshalKeepingEmptyStrings(val interface{}) (Item, error) {
+	encoder := dynamodbattribute.NewEncoder(func(e *dynamodbattribute.Encoder) {
+		e.NullEmptyString = false
+	})
+	av, err := encoder.Encode(val)
+	if err != nil || av == nil || av.M == nil {
+		return Item{}, err
+	}
+	return av.M, nil
+}
+
+// EmptyStringBehavior controls how empty strings are marshalled.
+type EmptyStringBehavior int
+
+const (
+	// EmptyStringDefault leaves empty strings as they are marshalled by the Marshaller,
+	// or by dynamodbattribute.MarshalMap, which marshals empty string struct fields as NULL.
+	EmptyStringDefault EmptyStringBehavior = iota
+	// EmptyStringNull marshals empty strings as NULL.
+	EmptyStringNull
+	// EmptyStringOmit omits attributes with empty string values.
+	EmptyStringOmit
+	// EmptyStringEmpty marshals empty strings as an empty String (S).
+	EmptyStringEmpty
+)
+
+// apply changes empty string attributes in the given attributes, and in any nested maps, in place.
+func (b EmptyStringBehavior) apply(attrs map[string]dynamodb.AttributeValue) {
+	if b == EmptyStringDefault || b == EmptyStringEmpty {
+		return
+	}
+	for name, attr := range attrs {
+		switch {
+		case attr.S != nil && *attr.S == "":
+			switch b {
+			case EmptyStringNull:
+				attrs[name] = dynamodb.AttributeValue{NULL: aws.Bool(true)}
+			case EmptyStringOmit:
+				delete(attrs, name)
+			}
+		case attr.M != nil:
+			b.apply(attr.M)
+		case attr.L != nil:
+			for _, elem := range attr.L {
+				if elem.M != nil {
+					b.apply(elem.M)
+				}
+			}
+		}
+	}
+}
+
+// ZeroValueBehavior controls which zero valued attributes are omitted when marshalled.
+type ZeroValueBehavior int
+
+const (
+	// ZeroValuesDefault leaves attributes as they are marshalled by the Marshaller, or by dynamodbattribute.MarshalMap,
+	// which only omits struct fields tagged omitempty. Other zero values are marshalled as is:
+	// false as a BOOL, zero as a Number (N), and nil pointers and interfaces, nil or empty slices and maps,
+	// structs with no marshalled fields, and empty strings (unless EmptyStringBehavior is set) as NULL.
+	ZeroValuesDefault ZeroValueBehavior = iota
+	// ZeroValuesOmitNull omits NULL attributes, so nil and empty values are not stored, but false and zero are.
+	ZeroValuesOmitNull
+	// ZeroValuesOmitAll omits NULL attributes, false BOOL attributes, Number (N) attributes equal to zero,
+	// and empty String (S) attributes, as if every struct field were tagged omitempty.
+	ZeroValuesOmitAll
+)
+
+// apply removes zero valued attributes from the given top level attributes, other than the given keys, in place.
+// Attributes in nested maps and lists are not changed.
+func (b ZeroValueBehavior) apply(attrs map[string]dynamodb.AttributeValue, keys ...string) {
+	if b == ZeroValuesDefault {
+		return
+	}
+	for name, attr := range attrs {
+		if b.omits(attr) && !containsString(keys, name) {
+			delete(attrs, name)
+		}
+	}
+}
+
+func (b ZeroValueBehavior) omits(attr dynamodb.AttributeValue) bool {
+	if attr.NULL != nil && *attr.NULL {
+		return true
+	}
+	if b != ZeroValuesOmitAll {
+		return false
+	}
+	switch {
+	case attr.BOOL != nil:
+		return !*attr.BOOL
+	case attr.N != nil:
+		n, ok := new(big.Rat).SetString(*attr.N)
+		return ok && n.Sign() == 0
+	case attr.S != nil:
+		return *attr.S == ""
+	}
+	return false
+}
+
+func containsString(vals []string, val string) bool {
+	for _, v := range vals {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
+// now returns the current time from Clock, or time.Now if Clock is nil.
+func (tc TableConfig) now() time.Time {
+	if tc.Clock == nil {
+		return time.Now()
+	}
+	return tc.Clock()
+}
+
+// TTLName returns the name of the time to live attribute that is used when TimeToLiveDuration is set,
+// which is TimeToLiveName, or DefaultTimeToLiveName if TimeToLiveName is empty.
+func (tc TableConfig) TTLName() string {
+	if tc.TimeToLiveName == "" {
+		return DefaultTimeToLiveName
+	}
+	return tc.TimeToLiveName
+}
+
+// Validate returns an error if the options of this config conflict, such as ErrTimeToLiveNameRequired.
+func (tc TableConfig) Validate() error {
+	if tc.RequireTimeToLiveName && tc.TimeToLiveDuration != 0 && tc.TimeToLiveName == "" {
+		return ErrTimeToLiveNameRequired
+	}
+	_, _, _, err := tc.scanSegments()
+	return err
+}
+
+// scanSegments returns the total number of segments table scans are split into,
+// and the first and number of segments to read, as configured.
+func (tc TableConfig) scanSegments() (total, first, count int, err error) {
+	total = tc.ScanSegments
+	if workers := tc.ScanConcurrency; total < workers {
+		total = workers
+	}
+	if total < 1 {
+		total = 1
+	}
+	if tc.SegmentCount <= 0 {
+		return total, 0, total, nil
+	}
+	if tc.SegmentOffset < 0 || tc.SegmentOffset+tc.SegmentCount > tc.ScanSegments {
+		return 0, 0, 0, fmt.Errorf("scan segments %d to %d are not within %d ScanSegments",
+			tc.SegmentOffset, tc.SegmentOffset+tc.SegmentCount-1, tc.ScanSegments)
+	}
+	return tc.ScanSegments, tc.SegmentOffset, tc.SegmentCount, nil
+}
+
 // ToKeyItem returns an item with only the configured key(s) copied from the given item.
 func (tc TableConfig) ToKeyItem(item Item) Item {
+	if built, err := tc.buildKeys(item, false); err == nil {
+		item = built
+	}
 	if tc.Ranged() {
 		return item.Project(tc.HashKeyName, tc.RangeKeyName)
 	}
 	return item.Project(tc.HashKeyName)
 }
 
+// buildKeys returns a copy of the item with the key attributes built by HashKeyBuilder and RangeKeyBuilder, if set.
+// If all is false, only missing key attributes are built. Returns an error if a built key is empty.
+func (tc TableConfig) buildKeys(item Item, all bool) (Item, error) {
+	buildHash := tc.HashKeyBuilder != nil && (all || !item.Exists(tc.HashKeyName))
+	buildRange := tc.RangeKeyBuilder != nil && tc.Ranged() && (all || !item.Exists(tc.RangeKeyName))
+	if !buildHash && !buildRange {
+		return item, nil
+	}
+	result := make(Item, len(item)+2)
+	for name, av := range item {
+		result[name] = av
+	}
+	if buildHash {
+		if err := buildKey(result, tc.HashKeyName, tc.HashKeyBuilder(item)); err != nil {
+			return nil, err
+		}
+	}
+	if buildRange {
+		if err := buildKey(result, tc.RangeKeyName, tc.RangeKeyBuilder(item)); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func buildKey(item Item, name, built string) error {
+	if built == "" {
+		return fmt.Errorf("built key attribute is empty: %v", name)
+	}
+	item[name] = ddbconv.EncodeString(built)
+	return nil
+}
+
+// checkBuiltKeys returns an error if the key attributes of a loaded item differ from those built from it
+// by HashKeyBuilder and RangeKeyBuilder, if set.
+func (tc TableConfig) checkBuiltKeys(item Item) error {
+	built, err := tc.buildKeys(item, true)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{tc.HashKeyName, tc.RangeKeyName} {
+		if name == "" {
+			continue
+		}
+		stored, _ := ddbconv.TryDecodeString(item[name])
+		if want, _ := ddbconv.TryDecodeString(built[name]); stored != want {
+			return fmt.Errorf("stored key attribute %v is %q, but %q was built from the item", name, stored, want)
+		}
+	}
+	return nil
+}
+
+// KeyOf marshals the given value with MarshalItem, and returns only its configured key(s),
+// which can be passed to methods such as LoadItem or DeleteItem without defining a separate key type.
+// It returns an error if the value has no hash key, or no range key if the table is ranged.
+func (tc TableConfig) KeyOf(val interface{}) (Itemable, error) {
+	item, err := tc.MarshalItem(val)
+	if err != nil {
+		return nil, err
+	}
+	key := tc.ToKeyItem(item)
+	if !key.Exists(tc.HashKeyName) {
+		return nil, fmt.Errorf("value has no hash key attribute: %v", tc.HashKeyName)
+	}
+	if tc.Ranged() && !key.Exists(tc.RangeKeyName) {
+		return nil, fmt.Errorf("value has no range key attribute: %v", tc.RangeKeyName)
+	}
+	return key, nil
+}
+
+// checkKeyTypes returns an error if any key attribute in the item does not have the configured key type.
+// If CoerceKeyTypes is true, mismatched key attributes are converted where possible, in a copy of the item.
+func (tc TableConfig) checkKeyTypes(item Item) (Item, error) {
+	keyTypes := map[string]dynamodb.ScalarAttributeType{tc.HashKeyName: tc.HashKeyType}
+	if tc.Ranged() {
+		keyTypes[tc.RangeKeyName] = tc.RangeKeyType
+	}
+	result, copied := item, false
+	for name, expected := range keyTypes {
+		av, ok := item[name]
+		if !ok || expected == "" {
+			continue
+		}
+		actual := scalarType(av)
+		if actual == expected {
+			continue
+		}
+		if tc.CoerceKeyTypes {
+			if coerced, ok := coerceScalar(av, expected); ok {
+				if !copied {
+					result, copied = make(Item, len(item)), true
+					for k, v := range item {
+						result[k] = v
+					}
+				}
+				result[name] = coerced
+				continue
+			}
+		}
+		return nil, fmt.Errorf("key attribute %v has type %v, but the table expects type %v", name, actual, expected)
+	}
+	return result, nil
+}
+
+// scalarType returns the scalar type of the given value, or an empty type if the value is not a scalar.
+func scalarType(av dynamodb.AttributeValue) dynamodb.ScalarAttributeType {
+	switch {
+	case av.S != nil:
+		return dynamodb.ScalarAttributeTypeS
+	case av.N != nil:
+		return dynamodb.ScalarAttributeTypeN
+	case av.B != nil:
+		return dynamodb.ScalarAttributeTypeB
+	}
+	return ""
+}
+
+// coerceScalar converts between numbers and strings that hold numbers.
+func coerceScalar(av dynamodb.AttributeValue, to dynamodb.ScalarAttributeType) (dynamodb.AttributeValue, bool) {
+	switch {
+	case to == dynamodb.ScalarAttributeTypeN && av.S != nil && isDecimal(*av.S):
+		return dynamodb.AttributeValue{N: aws.String(strings.TrimSpace(*av.S))}, true
+	case to == dynamodb.ScalarAttributeTypeS && av.N != nil:
+		return dynamodb.AttributeValue{S: aws.String(*av.N)}, true
+	}
+	return av, false
+}
+
+// isDecimal returns true if the string is a decimal number DynamoDB will accept, such as "-12", "3.5", or "1e10".
+func isDecimal(s string) bool {
+	s = strings.TrimSpace(s)
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		s = s[1:]
+	}
+	digits, dot, exp := 0, false, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= '0' && c <= '9':
+			digits++
+		case c == '.' && !dot && !exp:
+			dot = true
+		case (c == 'e' || c == 'E') && digits > 0 && !exp:
+			exp = true
+			digits = 0
+			if i+1 < len(s) && (s[i+1] == '-' || s[i+1] == '+') {
+				i++
+			}
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
+
 // NewMap creates a map view of a DynamoDB table from a TableConfig.
 // If the table does not exist or is being deleted or there is an error, the pointer result will be nil.
 // If ScanTableIfNotExists is true and the table does not exist, it will be created.
 // If ScanTableIfNotExists is false and the key names are not set, they will be looked up.
+// If Reconcile is true and the table already exists, it will be updated to match the table options.
 // If the logger has not been configured, either the AWS config's logger (if present) or stdout will be used.
+// An error is returned if the config is not valid, as checked by Validate.
 func (tc TableConfig) NewMap(cfg aws.Config) (*DynamoMap, error) {
+	return tc.NewMapWithContext(context.Background(), cfg)
+}
+
+// NewMapWithContext is like NewMap, but stops waiting and returns the context error
+// if the context is done while waiting for the table to become usable.
+func (tc TableConfig) NewMapWithContext(ctx context.Context, cfg aws.Config) (*DynamoMap, error) {
+	if err := tc.Validate(); err != nil {
+		return nil, err
+	}
 	if tc.Logger == nil {
 		if cfg.Logger == nil {
 			tc.Logger = logTo(os.Stdout)
@@ -96,12 +640,18 @@ func (tc TableConfig) NewMap(cfg aws.Config) (*DynamoMap, error) {
 	err := error(nil)
 
 	if tc.CreateTableIfAbsent {
-		status, err = dmap.DescribeTable(false)
+		status, err = dmap.DescribeTableWithContext(ctx, false)
 		if "" == status {
 			err = dmap.CreateTable()
+			dmap.createdTable = err == nil
+			if err == nil && tc.PointInTimeRecovery {
+				if status, err = dmap.DescribeTableWithContext(ctx, false); err == nil {
+					err = dmap.enablePITR(ctx)
+				}
+			}
 		}
 	} else if "" == tc.HashKeyName {
-		status, err = dmap.DescribeTable(true)
+		status, err = dmap.DescribeTableWithContext(ctx, true)
 		if "" == status {
 			return nil, errors.New("table does not exist, and hash key name is empty")
 		}
@@ -109,8 +659,13 @@ func (tc TableConfig) NewMap(cfg aws.Config) (*DynamoMap, error) {
 	if err != nil {
 		return nil, err
 	}
-	if dmap.TimeToLiveDuration > 0 {
-		err = dmap.EnableTTL()
+	if tc.Reconcile && !dmap.createdTable {
+		err = dmap.ReconcileTable()
+		if err != nil {
+			return nil, err
+		}
+	} else if dmap.TimeToLiveDuration > 0 {
+		_, err = dmap.EnableTTL()
 		if err != nil {
 			return nil, err
 		}
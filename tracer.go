@@ -0,0 +1,31 @@
+package ddbmap
+
+import "context"
+
+// Tracer starts spans for distributed tracing, such as with OpenTelemetry, around requests sent to DynamoDB.
+// Implementations adapt this to a tracing library, so this package does not depend on one.
+type Tracer interface {
+	// StartSpan starts a span for a request as a child of any span in the given context.
+	// It returns the context the request is sent with, and a function that ends the span,
+	// which is passed the error returned by the request, if any.
+	StartSpan(ctx context.Context, span SpanInfo) (context.Context, func(err error))
+}
+
+// SpanInfo describes a request being traced.
+type SpanInfo struct {
+	// Table is the name of the table.
+	Table string
+	// Operation is the name of the DynamoDB API operation, such as PutItem.
+	Operation string
+	// Key is the key item of the request, for operations on a single item. Otherwise it is nil.
+	Key Item
+}
+
+// startSpan starts a span with the Tracer, if there is one.
+// The returned function must be called with the request error, and does nothing if there is no Tracer.
+func (d *DynamoMap) startSpan(ctx context.Context, op string, key Item) (context.Context, func(error)) {
+	if d.Tracer == nil {
+		return ctx, func(error) {}
+	}
+	return d.Tracer.StartSpan(ctx, SpanInfo{Table: d.TableName, Operation: op, Key: key})
+}
@@ -0,0 +1,105 @@
+package ddbmap
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// Transaction builds a set of writes that are applied atomically with TransactWriteItems when committed,
+// so either every write is applied, or, if any condition fails, none are.
+// At most MaxTransactionItems writes may be added, and each must be to a different item.
+// A Transaction is not safe for concurrent use.
+type Transaction struct {
+	table  *DynamoMap
+	writes []dynamodb.TransactWriteItem
+	err    error
+}
+
+// NewTransaction creates an empty Transaction that writes to this map.
+func (d *DynamoMap) NewTransaction() *Transaction {
+	return &Transaction{table: d}
+}
+
+// Put adds storing the given item, clobbering any existing item with the same key(s).
+func (tx *Transaction) Put(item Itemable) *Transaction {
+	return tx.put(item.AsItem(), nil)
+}
+
+// PutIfAbsent adds storing the given item, if there is no existing item with the same key(s).
+func (tx *Transaction) PutIfAbsent(item Itemable) *Transaction {
+	condition, err := tx.table.absentCondition()
+	if err != nil {
+		tx.fail(err)
+		return tx
+	}
+	return tx.put(item.AsItem(), condition)
+}
+
+// PutIfVersion adds storing the given item, if there is an existing item with the same key(s) and the given version,
+// as with StoreItemIfVersion. The given item should hold its new version.
+func (tx *Transaction) PutIfVersion(item Itemable, version int64) *Transaction {
+	if tx.table.VersionName == "" {
+		tx.fail(errors.New("version name is empty"))
+		return tx
+	}
+	condition, err := tx.table.versionCondition(version)
+	if err != nil {
+		tx.fail(err)
+		return tx
+	}
+	return tx.put(item.AsItem(), condition)
+}
+
+// Delete adds deleting any existing item with the same key(s) as the given item.
+func (tx *Transaction) Delete(key Itemable) *Transaction {
+	keyItem, err := tx.table.checkKeyTypes(tx.table.ToKeyItem(key.AsItem()))
+	if err != nil {
+		tx.fail(err)
+		return tx
+	}
+	tx.writes = append(tx.writes, dynamodb.TransactWriteItem{Delete: &dynamodb.Delete{
+		TableName: &tx.table.TableName,
+		Key:       keyItem,
+	}})
+	return tx
+}
+
+// Commit applies every write added to the transaction atomically. Returns false without error if any
+// condition failed, in which case no write was applied. Returns an error if adding any write failed,
+// such as an item with invalid keys, or if there are more than MaxTransactionItems writes.
+func (tx *Transaction) Commit() (committed bool, err error) {
+	if tx.err != nil {
+		return false, tx.err
+	}
+	if len(tx.writes) == 0 {
+		return true, nil
+	}
+	if len(tx.writes) > MaxTransactionItems {
+		return false, fmt.Errorf("cannot write %d items in a transaction, max %d", len(tx.writes), MaxTransactionItems)
+	}
+	return tx.table.transactWrite(tx.writes)
+}
+
+func (tx *Transaction) put(item Item, condition *builtCondition) *Transaction {
+	prepared, err := tx.table.prepareItem(item, true, false)
+	if err != nil {
+		tx.fail(err)
+		return tx
+	}
+	put := &dynamodb.Put{TableName: &tx.table.TableName, Item: prepared}
+	if condition != nil {
+		put.ConditionExpression = condition.expression
+		put.ExpressionAttributeNames = condition.names
+		put.ExpressionAttributeValues = condition.values
+	}
+	tx.writes = append(tx.writes, dynamodb.TransactWriteItem{Put: put})
+	return tx
+}
+
+// fail records the first error from adding a write, which is returned by Commit.
+func (tx *Transaction) fail(err error) {
+	if tx.err == nil {
+		tx.err = err
+	}
+}
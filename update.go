@@ -0,0 +1,215 @@
+package ddbmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/expression"
+	"github.com/shawnsmithdev/ddbmap/ddbconv"
+	"math/big"
+	"sort"
+)
+
+// Upsert sets and removes the given attributes of the item with the same key(s) as the given key,
+// creating the item if it does not exist. Other existing attributes are preserved.
+// It uses a single UpdateItem request, so unlike Store it merges rather than replaces the item.
+// If TimeToLiveDuration is set, the time to live attribute is also set.
+func (d *DynamoMap) Upsert(key Itemable, set map[string]dynamodb.AttributeValue, remove []string) error {
+	update, err := d.updateBuilder(set, remove)
+	if err != nil {
+		return err
+	}
+	input, err := d.updateInput(key.AsItem(), update, nil)
+	if err != nil {
+		return err
+	}
+	_, err = d.update(context.Background(), input)
+	return err
+}
+
+// ItemUpdate describes a change to one item, as with Upsert.
+type ItemUpdate struct {
+	// The key(s) of the item to update.
+	Key Itemable
+	// The attributes to set.
+	Set map[string]dynamodb.AttributeValue
+	// The names of the attributes to remove.
+	Remove []string
+}
+
+// UpdateItems applies each of the given updates, as with Upsert, creating any items that do not exist.
+// Updates are sent in transactions of up to MaxTransactionItems, each of which is applied atomically,
+// but the transactions are sent one after another, so if an error is returned some may have been applied.
+// Each transaction may not update the same item more than once, so updates to the same item should be combined.
+// Transactions consume twice the write capacity of the same updates sent individually.
+func (d *DynamoMap) UpdateItems(updates []ItemUpdate) error {
+	writes := make([]dynamodb.TransactWriteItem, 0, len(updates))
+	for _, u := range updates {
+		update, err := d.updateBuilder(u.Set, u.Remove)
+		if err != nil {
+			return err
+		}
+		input, err := d.updateInput(u.Key.AsItem(), update, nil)
+		if err != nil {
+			return err
+		}
+		writes = append(writes, dynamodb.TransactWriteItem{Update: &dynamodb.Update{
+			TableName:                 input.TableName,
+			Key:                       input.Key,
+			UpdateExpression:          input.UpdateExpression,
+			ExpressionAttributeNames:  input.ExpressionAttributeNames,
+			ExpressionAttributeValues: input.ExpressionAttributeValues,
+		}})
+	}
+	for len(writes) > 0 {
+		n := len(writes)
+		if n > MaxTransactionItems {
+			n = MaxTransactionItems
+		}
+		if _, err := d.transactWrite(writes[:n]); err != nil {
+			return err
+		}
+		writes = writes[n:]
+	}
+	return nil
+}
+
+// updateBuilder builds an update that sets and removes the given attributes, and sets the TTL attribute if any.
+// Attribute codecs are applied to set values.
+func (d *DynamoMap) updateBuilder(set map[string]dynamodb.AttributeValue, remove []string) (expression.UpdateBuilder, error) {
+	var update expression.UpdateBuilder
+	encoded, err := d.encodeItem(set)
+	if err != nil {
+		return update, err
+	}
+	names := make([]string, 0, len(encoded))
+	for name := range encoded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		update = update.Set(expression.Name(name), exprValue(encoded[name]))
+	}
+	for _, name := range remove {
+		update = update.Remove(expression.Name(name))
+	}
+	if d.TimeToLiveDuration <= 0 && d.UpdatedAtName == "" && d.CreatedAtName == "" &&
+		len(names) == 0 && len(remove) == 0 {
+		return update, errors.New("no attributes to update")
+	}
+	return d.setTTL(update), nil
+}
+
+// setTTL adds setting the TTL attribute to an update, if TimeToLiveDuration is set,
+// and setting the UpdatedAtName and CreatedAtName attributes, if set.
+// The CreatedAtName attribute is only set if the item does not already have it.
+func (d *DynamoMap) setTTL(update expression.UpdateBuilder) expression.UpdateBuilder {
+	now := d.now()
+	if d.TimeToLiveDuration > 0 {
+		ttl := ddbconv.EncodeInt(int(now.Add(d.TimeToLiveDuration).Unix()))
+		update = update.Set(expression.Name(d.TTLName()), exprValue(ttl))
+	}
+	if d.UpdatedAtName != "" {
+		update = update.Set(expression.Name(d.UpdatedAtName), exprValue(ddbconv.EncodeInt64(now.Unix())))
+	}
+	if d.CreatedAtName != "" {
+		name := expression.Name(d.CreatedAtName)
+		update = update.Set(name, name.IfNotExists(exprValue(ddbconv.EncodeInt64(now.Unix()))))
+	}
+	return update
+}
+
+// AddToAttributeBounded atomically adds delta to the number attribute attr of the item with the same key(s)
+// as the given key, if the result would be between min and max, inclusive, and returns the new value.
+// A missing attribute, or item, is treated as zero, and is created.
+// If the result would be out of bounds, nothing is changed and stored is false.
+// If TimeToLiveDuration is set, the time to live attribute is also set.
+func (d *DynamoMap) AddToAttributeBounded(key Itemable, attr string, delta, min, max int64) (newValue int64,
+	stored bool, err error) {
+	if min > max {
+		return 0, false, fmt.Errorf("invalid bounds, min %d is greater than max %d", min, max)
+	}
+	name := expression.Name(attr)
+	update := d.setTTL(expression.Add(name, expression.Value(delta)))
+	lower, upper := addBounds(delta, min, max)
+	condition := name.Between(exprValue(ddbconv.EncodeNumber(lower)), exprValue(ddbconv.EncodeNumber(upper)))
+	if min <= delta && delta <= max {
+		condition = expression.Or(name.AttributeNotExists(), condition)
+	}
+	input, err := d.updateInput(key.AsItem(), update, &condition)
+	if err != nil {
+		return 0, false, err
+	}
+	input.ReturnValues = dynamodb.ReturnValueUpdatedNew
+	result, err := d.update(context.Background(), input)
+	if err != nil {
+		if dynamodb.ErrCodeConditionalCheckFailedException == getErrCode(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	if av, ok := result[attr]; ok {
+		newValue, ok = ddbconv.TryDecodeInt64(av)
+		if !ok {
+			return 0, true, fmt.Errorf("attribute %v is not an integer: %v", attr, av)
+		}
+	}
+	return newValue, true, nil
+}
+
+// addBounds returns the bounds, inclusive, that an existing value must be between for adding delta to it
+// to give a value between min and max. They are computed exactly, as either may be out of the range of int64.
+func addBounds(delta, min, max int64) (lower, upper dynamodbattribute.Number) {
+	bigDelta := big.NewInt(delta)
+	lower = dynamodbattribute.Number(new(big.Int).Sub(big.NewInt(min), bigDelta).String())
+	upper = dynamodbattribute.Number(new(big.Int).Sub(big.NewInt(max), bigDelta).String())
+	return lower, upper
+}
+
+// updateInput builds an UpdateItem request for the item with the key(s) of the given item.
+func (d *DynamoMap) updateInput(key Item, update expression.UpdateBuilder,
+	condition *expression.ConditionBuilder) (*dynamodb.UpdateItemInput, error) {
+	key, err := d.checkKeyTypes(d.ToKeyItem(key))
+	if err != nil {
+		return nil, err
+	}
+	builder := expression.NewBuilder().WithUpdate(update)
+	if condition != nil {
+		builder = builder.WithCondition(*condition)
+	}
+	expr, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.UpdateItemInput{
+		TableName:                 &d.TableName,
+		Key:                       key,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ReturnConsumedCapacity:    d.returnCapacity(),
+	}, nil
+}
+
+// update sends an UpdateItem request, returning any attributes requested by ReturnValues.
+func (d *DynamoMap) update(ctx context.Context, input *dynamodb.UpdateItemInput) (Item, error) {
+	if d.dryRun("update", input) {
+		return nil, nil
+	}
+	d.debug("update request input:", input)
+	req := d.Client.UpdateItemRequest(input)
+	sendCtx, end := d.startSpan(ctx, "UpdateItem", input.Key)
+	resp, err := req.Send(sendCtx)
+	err = requestError("UpdateItem", req.Request, err)
+	d.onRequestError(err)
+	end(err)
+	d.debug("update response:", resp, ", error:", err)
+	if err != nil {
+		return nil, err
+	}
+	d.reportCapacityOf("update", resp.ConsumedCapacity)
+	return d.decodeItem(resp.Attributes)
+}
@@ -0,0 +1,32 @@
+package ddbmap
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"math"
+	"testing"
+)
+
+func TestAddBounds(t *testing.T) {
+	tests := []struct {
+		delta, min, max int64
+		lower, upper    dynamodbattribute.Number
+	}{
+		{delta: 1, min: 0, max: 10, lower: "-1", upper: "9"},
+		{delta: -3, min: 0, max: 10, lower: "3", upper: "13"},
+		{delta: 0, min: -5, max: 5, lower: "-5", upper: "5"},
+		{delta: 1, min: math.MinInt64, max: math.MaxInt64,
+			lower: "-9223372036854775809", upper: "9223372036854775806"},
+		{delta: -1, min: math.MinInt64, max: math.MaxInt64,
+			lower: "-9223372036854775807", upper: "9223372036854775808"},
+		{delta: math.MinInt64, min: 0, max: math.MaxInt64,
+			lower: "9223372036854775808", upper: "18446744073709551615"},
+		{delta: math.MaxInt64, min: math.MinInt64, max: 0,
+			lower: "-18446744073709551615", upper: "-9223372036854775807"},
+	}
+	for _, test := range tests {
+		lower, upper := addBounds(test.delta, test.min, test.max)
+		if lower != test.lower || upper != test.upper {
+			t.Error("for", test.delta, test.min, test.max, "expected", test.lower, test.upper, "got", lower, upper)
+		}
+	}
+}
@@ -3,14 +3,45 @@ package ddbmap
 import (
 	"context"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"sync/atomic"
+	"time"
 )
 
+// ScanReport summarizes a completed scan across all scan workers.
+type ScanReport struct {
+	// The number of items read.
+	Items int64
+	// The number of pages read.
+	Pages int64
+	// The number of times scan requests were retried by the client.
+	Retries int64
+	// The wall time taken by the scan.
+	Elapsed time.Duration
+}
+
+// add counts a page read by a scan worker.
+func (r *ScanReport) add(items int, retries int) {
+	if r != nil {
+		atomic.AddInt64(&r.Items, int64(items))
+		atomic.AddInt64(&r.Pages, 1)
+		atomic.AddInt64(&r.Retries, int64(retries))
+	}
+}
+
 type scanWorker struct {
 	workerID int64
 	input    *dynamodb.ScanInput
 	table    *DynamoMap
-	consumer func(Item) bool
-	ctx      context.Context
+	// returns errEarlyTermination, or any other error, to stop
+	consumer func(Item) error
+	// the context scan requests are sent with, which also stops the scan between pages when done, may be nil
+	ctx context.Context
+	// items read so far by this worker
+	itemCount int64
+	// the key(s) of the last item the consumer finished with, either returning nil or errEarlyTermination
+	lastKey Item
+	// shared by all workers in a scan, may be nil
+	report *ScanReport
 }
 
 func (s scanWorker) withID(workerID int, input dynamodb.ScanInput) *scanWorker {
@@ -26,30 +57,51 @@ func (s *scanWorker) debug(input ...interface{}) {
 
 func (s *scanWorker) work() error {
 	s.debug("starting scan")
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	for {
 		// fetch a page
 		s.debug("scan request input:", s.input)
-		resp, err := s.table.Client.ScanRequest(s.input).Send(context.Background())
+		req := s.table.reader().ScanRequest(s.input)
+		sendCtx, end := s.table.startSpan(ctx, "Scan", nil)
+		resp, err := req.Send(sendCtx)
+		err = requestError("Scan", req.Request, err)
+		s.table.onRequestError(err)
+		end(err)
 		s.debug("scan response:", resp, "error:", err)
 		if err != nil {
 			return err
 		}
+		s.report.add(len(resp.Items), req.RetryCount)
+		s.table.reportCapacityOf("scan", resp.ConsumedCapacity)
 		// run consumer on each record in page
 		for _, item := range resp.Items {
-			if !s.consumer(item) {
-				s.debug("scan worker received early termination")
-				return errEarlyTermination
+			decoded, err := s.table.decodeItem(item)
+			if err != nil {
+				return err
+			}
+			err = s.consumer(decoded)
+			if err == nil || err == errEarlyTermination {
+				s.lastKey = s.table.ToKeyItem(item)
+			}
+			if err != nil {
+				s.debug("scan worker received early termination, err:", err)
+				return err
 			}
 		}
+		s.itemCount += int64(len(resp.Items))
+		if s.table.OnScanProgress != nil {
+			s.table.OnScanProgress(int(s.workerID), s.itemCount)
+		}
 		if resp.LastEvaluatedKey == nil {
 			s.debug("scan done")
 			return nil
 		}
-		if s.ctx != nil {
-			if err := s.ctx.Err(); err != nil {
-				s.debug("scan worker peer early termination, err:", err)
-				return errEarlyTermination
-			}
+		if err := ctx.Err(); err != nil {
+			s.debug("scan worker early termination, err:", err)
+			return errEarlyTermination
 		}
 		s.input.ExclusiveStartKey = resp.LastEvaluatedKey
 	}
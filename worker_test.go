@@ -0,0 +1,164 @@
+package ddbmap
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/defaults"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/shawnsmithdev/ddbmap/ddbconv"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeDynamoError is returned by a fakeDynamo handler to respond with an AWS error.
+type fakeDynamoError struct {
+	Code    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+// fakeDynamo serves DynamoDB JSON requests with the given handler, which is passed the operation name,
+// such as Scan, and the request body, and returns the response body, or a fakeDynamoError.
+func fakeDynamo(t *testing.T, handle func(op string, body []byte) interface{}) (*dynamodb.Client, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error("cannot read request body", err)
+		}
+		op := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		resp := handle(op, body)
+		if _, ok := resp.(fakeDynamoError); ok {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Error("cannot write response", err)
+		}
+	}))
+	cfg := defaults.Config()
+	cfg.Region = "us-west-2"
+	cfg.Credentials = aws.NewStaticCredentialsProvider("key", "secret", "")
+	cfg.EndpointResolver = aws.ResolveWithEndpointURL(server.URL)
+	cfg.Retryer = aws.DefaultRetryer{NumMaxRetries: 0}
+	return dynamodb.New(cfg), server.Close
+}
+
+// unexpectedRequest fails the test, from a fakeDynamo handler, and returns an error response for the request.
+// Handlers run on the server goroutine, so must not call t.Fatal.
+func unexpectedRequest(t *testing.T, args ...interface{}) fakeDynamoError {
+	t.Error(args...)
+	return fakeDynamoError{Code: "ValidationException", Message: "unexpected request"}
+}
+
+// fakeScanTable returns a handler that scans the given items, ordered by their Id attribute, in pages of pageSize.
+func fakeScanTable(t *testing.T, items []Item, pageSize int) func(string, []byte) interface{} {
+	return func(op string, body []byte) interface{} {
+		if op != "Scan" {
+			return unexpectedRequest(t, "unexpected operation", op)
+		}
+		var input dynamodb.ScanInput
+		if err := json.Unmarshal(body, &input); err != nil {
+			return unexpectedRequest(t, "cannot parse scan input", err)
+		}
+		start := 0
+		if startID, ok := ddbconv.TryDecodeString(input.ExclusiveStartKey["Id"]); ok {
+			for start < len(items) && ddbconv.DecodeString(items[start]["Id"]) <= startID {
+				start++
+			}
+		}
+		end := start + pageSize
+		if end > len(items) {
+			end = len(items)
+		}
+		resp := dynamodb.ScanOutput{Count: aws.Int64(int64(end - start))}
+		for _, item := range items[start:end] {
+			resp.Items = append(resp.Items, item)
+		}
+		if end < len(items) {
+			resp.LastEvaluatedKey = items[end-1].Project("Id")
+		}
+		return resp
+	}
+}
+
+func TestRangeItemsBudgetResumesWithoutSkipping(t *testing.T) {
+	var items []Item
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		items = append(items, Item{"Id": ddbconv.EncodeString(id)})
+	}
+	client, closeServer := fakeDynamo(t, fakeScanTable(t, items, 2))
+	defer closeServer()
+	d := &DynamoMap{TableConfig: TableConfig{TableName: "Test", HashKeyName: "Id"}, Client: client}
+
+	seen := make(map[string]int)
+	var token []byte
+	slices := 0
+	for {
+		var err error
+		// a zero budget is spent after the first item of each slice
+		token, err = d.RangeItemsBudgetFrom(token, 0, func(item Item) bool {
+			seen[ddbconv.DecodeString(item["Id"])]++
+			return true
+		})
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		slices++
+		if token == nil {
+			break
+		}
+		if slices > 2*len(items) {
+			t.Fatal("scan did not finish, token:", string(token))
+		}
+	}
+	if slices < 2 {
+		t.Fatal("expected at least two budget slices, got", slices)
+	}
+	for _, item := range items {
+		if id := ddbconv.DecodeString(item["Id"]); seen[id] != 1 {
+			t.Error("expected item", id, "to be seen once, seen", seen[id], "times")
+		}
+	}
+	if len(seen) != len(items) {
+		t.Error("expected", len(items), "items, got", seen)
+	}
+}
+
+func TestRangeItemsChanStopsOnEmptyPagesWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var requests int32
+	client, closeServer := fakeDynamo(t, func(op string, body []byte) interface{} {
+		// a filtered scan that matches nothing reads empty pages until the table ends
+		switch atomic.AddInt32(&requests, 1) {
+		case 3:
+			cancel()
+		case 100:
+			return dynamodb.ScanOutput{Count: aws.Int64(0)}
+		}
+		return dynamodb.ScanOutput{Count: aws.Int64(0), LastEvaluatedKey: Item{"Id": ddbconv.EncodeString("a")}}
+	})
+	defer closeServer()
+	d := &DynamoMap{TableConfig: TableConfig{TableName: "Test", HashKeyName: "Id"}, Client: client}
+
+	items, errs := d.RangeItemsChan(ctx)
+	for item := range items {
+		t.Error("unexpected item", item)
+	}
+	select {
+	case err := <-errs:
+		if err != context.Canceled {
+			t.Error("expected", context.Canceled, "got", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the scan to stop once canceled")
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Error("expected 3 scan requests, got", n)
+	}
+}
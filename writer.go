@@ -0,0 +1,312 @@
+package ddbmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/expression"
+	"sync"
+	"time"
+)
+
+// ErrWriterClosed is returned when adding an item to a BufferedWriter that has been closed.
+var ErrWriterClosed = errors.New("buffered writer closed")
+
+// UnflushedError is returned by BufferedWriter.Close with the buffered items that were not stored,
+// either because the context was done first, or because storing them failed,
+// so they can be saved elsewhere rather than lost. Use errors.As to get an *UnflushedError from a returned error.
+type UnflushedError struct {
+	// Items are the items that were not stored. Some may have been stored if a request failed or was canceled.
+	// Items added with AddIf are included without their conditions.
+	Items []Item
+	// Err is the context error, or the first error from storing the items.
+	Err error
+}
+
+func (e *UnflushedError) Error() string {
+	return fmt.Sprintf("buffered writer failed to flush %d items: %v", len(e.Items), e.Err)
+}
+
+// Unwrap returns the context error, or the first error from storing the items.
+func (e *UnflushedError) Unwrap() error {
+	return e.Err
+}
+
+// bufferedWriters tracks the open buffered writers of each map, so they can be flushed when the map is closed.
+var bufferedWriters = struct {
+	sync.Mutex
+	byMap map[*DynamoMap][]*BufferedWriter
+}{byMap: make(map[*DynamoMap][]*BufferedWriter)}
+
+// BufferedWriterOptions configure when a BufferedWriter flushes items, and how it reports errors.
+type BufferedWriterOptions struct {
+	// MaxItems is how many items are buffered before they are flushed.
+	// If less than 1, 25 is used, the most that can be sent in one BatchWriteItem request.
+	MaxItems int
+	// FlushInterval is how often buffered items are flushed, even if there are fewer than MaxItems.
+	// If zero, items are only flushed when MaxItems is reached, or by Flush or Close.
+	FlushInterval time.Duration
+	// OnError, if not nil, is called with any error from a background flush and the items in that flush
+	// that were not stored, or may not have been. If nil, such errors are logged.
+	OnError func(err error, items []Item)
+	// OnConditionFailed, if not nil, is called with each item added with AddIf that was not stored
+	// because its condition was false. Such items are otherwise skipped without error.
+	OnConditionFailed func(item Item)
+}
+
+// BufferedWriter accumulates items and stores them in the background using BatchWriteItem,
+// or PutItem for items added with a condition.
+// It is safe for concurrent use. Items are not stored atomically, and are stored in no particular order,
+// except that if items with the same key(s) are added without a condition before a flush,
+// only the last of them is stored. Items added with AddIf are each stored with their own request.
+type BufferedWriter struct {
+	table    *DynamoMap
+	opts     BufferedWriterOptions
+	mu       sync.Mutex
+	pending  []bufferedItem
+	closed   bool
+	batches  chan []bufferedItem
+	inflight sync.WaitGroup
+	stopped  chan struct{}
+}
+
+// bufferedItem is an item added to a BufferedWriter, with its condition, if any.
+type bufferedItem struct {
+	item      Item
+	condition *builtCondition
+}
+
+// NewBufferedWriter creates a BufferedWriter that stores items in this map.
+// Buffered writers are flushed and closed when the map is closed.
+func (d *DynamoMap) NewBufferedWriter(opts BufferedWriterOptions) *BufferedWriter {
+	if opts.MaxItems < 1 {
+		opts.MaxItems = maxBatchWriteItems
+	}
+	w := &BufferedWriter{
+		table:   d,
+		opts:    opts,
+		batches: make(chan []bufferedItem),
+		stopped: make(chan struct{}),
+	}
+	bufferedWriters.Lock()
+	bufferedWriters.byMap[d] = append(bufferedWriters.byMap[d], w)
+	bufferedWriters.Unlock()
+	go w.run()
+	return w
+}
+
+func (w *BufferedWriter) run() {
+	defer close(w.stopped)
+	var tick <-chan time.Time
+	if w.opts.FlushInterval > 0 {
+		ticker := time.NewTicker(w.opts.FlushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case batch, ok := <-w.batches:
+			if !ok {
+				return
+			}
+			w.write(batch)
+			w.inflight.Done()
+		case <-tick:
+			if batch := w.takeInflight(); len(batch) > 0 {
+				w.write(batch)
+				w.inflight.Done()
+			}
+		}
+	}
+}
+
+// takeInflight is take, but also counts any items taken as a flush in progress, so Flush waits for them.
+func (w *BufferedWriter) takeInflight() []bufferedItem {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	batch := w.pending
+	w.pending = nil
+	if len(batch) > 0 {
+		w.inflight.Add(1)
+	}
+	return batch
+}
+
+// take removes and returns all pending items.
+func (w *BufferedWriter) take() []bufferedItem {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	batch := w.pending
+	w.pending = nil
+	return batch
+}
+
+// write stores the given items, reporting any error.
+func (w *BufferedWriter) write(batch []bufferedItem) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	failed, err := w.store(context.Background(), batch)
+	if err != nil {
+		if w.opts.OnError == nil {
+			w.table.log("buffered writer failed to store", len(failed), "items, error:", err)
+		} else {
+			w.opts.OnError(err, failed)
+		}
+	}
+	return err
+}
+
+// store stores the unconditional items of a batch with BatchWriteItem, and each conditional item with PutItem.
+// It returns the first error, and the items that were not stored, or may not have been.
+func (w *BufferedWriter) store(ctx context.Context, batch []bufferedItem) (failed []Item, err error) {
+	var unconditional []Item
+	for _, b := range batch {
+		if b.condition == nil {
+			unconditional = append(unconditional, b.item)
+			continue
+		}
+		stored, storeErr := w.table.storeIfBuilt(ctx, b.item, b.condition)
+		if storeErr != nil {
+			failed = append(failed, b.item)
+			if err == nil {
+				err = storeErr
+			}
+		} else if !stored && w.opts.OnConditionFailed != nil {
+			w.opts.OnConditionFailed(b.item)
+		}
+	}
+	if len(unconditional) > 0 {
+		if _, unstored, storeErr := w.table.putBatch(ctx, unconditional); storeErr != nil {
+			failed = append(failed, unstored...)
+			if err == nil {
+				err = storeErr
+			}
+		}
+	}
+	return failed, err
+}
+
+// Add buffers an item to be stored. If MaxItems are now buffered, they are passed to the background flush,
+// which blocks if the previous background flush is still in progress.
+func (w *BufferedWriter) Add(item Itemable) error {
+	return w.add(bufferedItem{item: item.AsItem()})
+}
+
+// AddIf buffers an item to be stored if the given condition is true, as evaluated against any existing item
+// with the same key(s), such as to skip duplicates. BatchWriteItem does not support conditions,
+// so each such item is stored with its own PutItem request when flushed, along with any unconditional items.
+// Items not stored because their condition was false are passed to OnConditionFailed, if set.
+func (w *BufferedWriter) AddIf(item Itemable, condition expression.ConditionBuilder) error {
+	built, err := buildCondition(condition)
+	if err != nil {
+		return err
+	}
+	return w.add(bufferedItem{item: item.AsItem(), condition: built})
+}
+
+func (w *BufferedWriter) add(item bufferedItem) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrWriterClosed
+	}
+	w.pending = append(w.pending, item)
+	if len(w.pending) < w.opts.MaxItems {
+		w.mu.Unlock()
+		return nil
+	}
+	batch := w.pending
+	w.pending = nil
+	w.inflight.Add(1)
+	w.mu.Unlock()
+	w.batches <- batch
+	return nil
+}
+
+// Flush stores all buffered items, and waits for any background flush in progress to finish.
+// It returns any error from storing the buffered items, which is also passed to OnError, if set.
+func (w *BufferedWriter) Flush() error {
+	err := w.write(w.take())
+	w.inflight.Wait()
+	return err
+}
+
+// Close flushes all buffered items and stops the background flush. Items cannot be added after Close.
+// Buffered items are stored in batches until the context is done. If any are not stored, they are returned in
+// an *UnflushedError, and are not passed to OnError. If the context is done while a background flush is still
+// in progress, the context error is returned, and that flush finishes in the background, reporting any error
+// to OnError as usual.
+func (w *BufferedWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	var unflushed []Item
+	var flushErr error
+	for pending := w.take(); len(pending) > 0; {
+		n := len(pending)
+		if n > maxBatchWriteItems {
+			n = maxBatchWriteItems
+		}
+		failed, err := itemsOf(pending[:n]), ctx.Err()
+		if err == nil {
+			failed, err = w.store(ctx, pending[:n])
+		}
+		if err != nil {
+			unflushed = append(unflushed, failed...)
+			if flushErr == nil {
+				flushErr = err
+			}
+		}
+		pending = pending[n:]
+	}
+
+	// the batches channel is only closed once no Add is sending to it
+	inflight := make(chan struct{})
+	go func() {
+		w.inflight.Wait()
+		close(w.batches)
+		close(inflight)
+	}()
+	var waitErr error
+	select {
+	case <-inflight:
+		<-w.stopped
+	case <-ctx.Done():
+		waitErr = ctx.Err()
+	}
+
+	bufferedWriters.Lock()
+	writers := bufferedWriters.byMap[w.table]
+	for i, other := range writers {
+		if other == w {
+			writers = append(writers[:i], writers[i+1:]...)
+			break
+		}
+	}
+	if len(writers) == 0 {
+		delete(bufferedWriters.byMap, w.table)
+	} else {
+		bufferedWriters.byMap[w.table] = writers
+	}
+	bufferedWriters.Unlock()
+
+	if len(unflushed) > 0 {
+		return &UnflushedError{Items: unflushed, Err: flushErr}
+	}
+	return waitErr
+}
+
+// itemsOf returns the items of the given buffered items, without their conditions.
+func itemsOf(batch []bufferedItem) []Item {
+	items := make([]Item, len(batch))
+	for i, b := range batch {
+		items[i] = b.item
+	}
+	return items
+}
@@ -0,0 +1,107 @@
+package ddbmap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/shawnsmithdev/ddbmap/ddbconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBufferedWriterReportsOnlyUnstoredItems(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	client, closeServer := fakeDynamo(t, func(op string, body []byte) interface{} {
+		if op != "BatchWriteItem" {
+			return unexpectedRequest(t, "unexpected operation", op)
+		}
+		var input dynamodb.BatchWriteItemInput
+		if err := json.Unmarshal(body, &input); err != nil {
+			return unexpectedRequest(t, "cannot parse batch write input", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests > 1 {
+			return fakeDynamoError{Code: "ValidationException", Message: "second batch rejected"}
+		}
+		return dynamodb.BatchWriteItemOutput{}
+	})
+	defer closeServer()
+	d := &DynamoMap{TableConfig: TableConfig{TableName: "Test", HashKeyName: "Id"}, Client: client}
+
+	var reported []Item
+	w := d.NewBufferedWriter(BufferedWriterOptions{MaxItems: 100, OnError: func(err error, items []Item) {
+		reported = items
+	}})
+	total := maxBatchWriteItems + 5
+	for i := 0; i < total; i++ {
+		if err := w.Add(Item{"Id": ddbconv.EncodeString(fmt.Sprintf("%03d", i))}); err != nil {
+			t.Fatal("unexpected error", err)
+		}
+	}
+	// an item with the same key as an earlier one replaces it, rather than failing the batch
+	if err := w.Add(Item{"Id": ddbconv.EncodeString("000"), "V": ddbconv.EncodeInt(1)}); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	err := w.Flush()
+	var dynamoErr *DynamoError
+	if !errors.As(err, &dynamoErr) || dynamoErr.Kind != ErrorValidation {
+		t.Fatal("expected a validation error, got", err)
+	}
+	if want := total - maxBatchWriteItems; len(reported) != want {
+		t.Fatal("expected", want, "unstored items, got", len(reported))
+	}
+	for _, item := range reported {
+		if id := ddbconv.DecodeString(item["Id"]); id < fmt.Sprintf("%03d", maxBatchWriteItems) {
+			t.Error("item", id, "was stored, but reported as unstored")
+		}
+	}
+	if err := w.Close(context.Background()); err != nil {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestBufferedWriterFlushWaitsForTimedFlush(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	client, closeServer := fakeDynamo(t, func(op string, body []byte) interface{} {
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+		return dynamodb.BatchWriteItemOutput{}
+	})
+	defer closeServer()
+	var releaseOnce sync.Once
+	releaseRequest := func() { releaseOnce.Do(func() { close(release) }) }
+	// the server cannot close while the request is blocked
+	defer releaseRequest()
+	d := &DynamoMap{TableConfig: TableConfig{TableName: "Test", HashKeyName: "Id"}, Client: client}
+
+	w := d.NewBufferedWriter(BufferedWriterOptions{FlushInterval: 5 * time.Millisecond})
+	if err := w.Add(Item{"Id": ddbconv.EncodeString("a")}); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	<-started
+	flushed := make(chan error, 1)
+	go func() {
+		flushed <- w.Flush()
+	}()
+	select {
+	case err := <-flushed:
+		t.Fatal("expected Flush to wait for the timed flush, got", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	releaseRequest()
+	if err := <-flushed; err != nil {
+		t.Error("unexpected error", err)
+	}
+	if err := w.Close(context.Background()); err != nil {
+		t.Error("unexpected error", err)
+	}
+}